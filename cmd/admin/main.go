@@ -0,0 +1,60 @@
+// Filename: cmd/admin/main.go
+
+// The admin command bootstraps the first administrator by granting the
+// users:admin permission directly in the database. Run it once after the
+// account has been registered:
+//
+//	go run ./cmd/admin -email=alice@example.com
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"alysianorales.net/TODO/internal/data"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	dsn := flag.String("db-dsn", os.Getenv("TODO_DB_DSN"), "PostgreSQL DSN")
+	email := flag.String("email", "", "Email address of the user to promote")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("the -email flag is required")
+	}
+
+	db, err := sql.Open("postgres", *dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	//Create context with a 5-second timeout deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = db.PingContext(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A one-off command has no use for the lookup cache
+	models := data.NewModels(db, 0)
+	user, err := models.Users.GetByEmail(*email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			log.Fatalf("no user with the email address %s", *email)
+		}
+		log.Fatal(err)
+	}
+	err = models.Permissions.AddForUser(user.ID, "users:admin")
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("granted users:admin to %s (id %d)", user.Email, user.ID)
+}
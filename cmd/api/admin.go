@@ -0,0 +1,288 @@
+// Filename: cmd/api/admin.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// listUsersHandler shows a page of user accounts to an administrator
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name  string
+		Email string
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Name = app.readString(qs, "name", "")
+	input.Email = app.readString(qs, "email", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortList = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	users, metadata, err := app.models.Users.GetAll(input.Name, input.Email, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"users": users, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listPermissionsHandler shows the permission codes that can be granted
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showUserPermissionsHandler shows the roles and permission codes a user holds
+func (app *application) showUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+	app.writeUserPermissions(w, r, user)
+}
+
+// grantUserPermissionsHandler adds permission codes to a user
+func (app *application) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+	codes, ok := app.readPermissionCodes(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Permissions.AddForUser(user.ID, codes...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.writeUserPermissions(w, r, user)
+}
+
+// revokeUserPermissionsHandler takes permission codes away from a user
+func (app *application) revokeUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+	codes, ok := app.readPermissionCodes(w, r)
+	if !ok {
+		return
+	}
+	if !app.checkSelfLockout(w, r, user, codes, nil) {
+		return
+	}
+	err := app.models.Permissions.RemoveForUser(user.ID, codes...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.writeUserPermissions(w, r, user)
+}
+
+// listRolesHandler shows the roles and the permission codes they bundle
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// grantUserRolesHandler gives roles to a user
+func (app *application) grantUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+	codes, ok := app.readRoleCodes(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Roles.AddForUser(user.ID, codes...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.writeUserPermissions(w, r, user)
+}
+
+// revokeUserRolesHandler takes roles away from a user
+func (app *application) revokeUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+	codes, ok := app.readRoleCodes(w, r)
+	if !ok {
+		return
+	}
+	if !app.checkSelfLockout(w, r, user, nil, codes) {
+		return
+	}
+	err := app.models.Roles.RemoveForUser(user.ID, codes...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.writeUserPermissions(w, r, user)
+}
+
+// showCacheStatsHandler shows operators how well the user cache is doing
+func (app *application) showCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.writeJSON(w, http.StatusOK, envelope{"cache": app.models.Cache.Stats()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkSelfLockout stops administrators from locking themselves out. An
+// administrator revoking their own permission or role codes must still hold
+// users:admin afterwards, whether directly or through another role. It
+// writes the error response itself and reports whether the handler should
+// carry on
+func (app *application) checkSelfLockout(w http.ResponseWriter, r *http.Request, user *data.User, permissionCodes, roleCodes []string) bool {
+	if user.ID != app.contextGetUser(r).ID {
+		return true
+	}
+	held, err := app.models.Permissions.HeldAfterRevoking(user.ID, "users:admin", permissionCodes, roleCodes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if !held {
+		v := validator.New()
+		v.AddError("codes", "you cannot revoke your own users:admin permission")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+	return true
+}
+
+// readUserParam fetches the user named by the "id" parameter. It writes the
+// error response itself and reports whether the handler should carry on
+func (app *application) readUserParam(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return user, true
+}
+
+// readPermissionCodes reads and validates a {"codes": [...]} request body
+func (app *application) readPermissionCodes(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var input struct {
+		Codes []string `json:"codes"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	v := validator.New()
+	v.Check(len(input.Codes) >= 1, "codes", "must contain at least one permission code")
+	v.Check(validator.Unique(input.Codes), "codes", "must not contain duplicate permission codes")
+	for _, code := range input.Codes {
+		v.Check(known.Include(code), "codes", "contains an unknown permission code")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+	return input.Codes, true
+}
+
+// readRoleCodes reads and validates a {"codes": [...]} request body of role codes
+func (app *application) readRoleCodes(w http.ResponseWriter, r *http.Request) ([]string, bool) {
+	var input struct {
+		Codes []string `json:"codes"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+	known := make([]string, 0, len(roles))
+	for _, role := range roles {
+		known = append(known, role.Code)
+	}
+	v := validator.New()
+	v.Check(len(input.Codes) >= 1, "codes", "must contain at least one role")
+	v.Check(validator.Unique(input.Codes), "codes", "must not contain duplicate roles")
+	for _, code := range input.Codes {
+		v.Check(validator.In(code, known...), "codes", "contains an unknown role")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+	return input.Codes, true
+}
+
+// writeUserPermissions sends the user's roles and the permission codes
+// they resolve to
+func (app *application) writeUserPermissions(w http.ResponseWriter, r *http.Request, user *data.User) {
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if permissions == nil {
+		permissions = data.Permissions{}
+	}
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user, "roles": roles, "permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,88 @@
+// Filename: cmd/api/assignees.go
+
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// validateAssignee() checks that the user a todo is assigned to can see
+// it, which means owning it or being a member of the list it is in
+func (app *application) validateAssignee(v *validator.Validator, todo *data.Todo) error {
+	if todo.AssigneeID == nil || *todo.AssigneeID == todo.UserID {
+		return nil
+	}
+	if todo.ListID != nil {
+		_, err := app.models.Lists.GetRole(*todo.ListID, *todo.AssigneeID)
+		switch {
+		case err == nil:
+			return nil
+		case !errors.Is(err, data.ErrRecordNotFound):
+			return err
+		}
+	}
+	v.AddError("assignee_id", "must be a user who can see the todo")
+	return nil
+}
+
+// readAssignee() reads the assignee filter of a todo listing, which is
+// either "me" or a user id. It returns 0 when the filter isn't set
+func (app *application) readAssignee(qs url.Values, userID int64, v *validator.Validator) int64 {
+	value := qs.Get("assignee")
+	switch value {
+	case "":
+		return 0
+	case "me":
+		return userID
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || id < 1 {
+		v.AddError("assignee", "must be me or a user id")
+		return 0
+	}
+	return id
+}
+
+// notifyAssignee() emails the user a todo has just been assigned to.
+// Nothing is sent when the assignee didn't change, or when people assign
+// todos to themselves
+func (app *application) notifyAssignee(todo *data.Todo, previousAssigneeID *int64, assigner *data.User) {
+	if todo.AssigneeID == nil || *todo.AssigneeID == assigner.ID {
+		return
+	}
+	if previousAssigneeID != nil && *previousAssigneeID == *todo.AssigneeID {
+		return
+	}
+	assigneeID, todoID := *todo.AssigneeID, todo.ID
+	data := map[string]interface{}{
+		"assignerName": assigner.Name,
+		"todoID":       todoID,
+		"title":        todo.Title,
+		"dueAt":        "",
+	}
+	if todo.DueAt != nil {
+		data["dueAt"] = todo.DueAt.Format(time.RFC1123)
+	}
+	app.background(func() {
+		assignee, err := app.models.Users.Get(assigneeID)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"todo_id": strconv.FormatInt(todoID, 10),
+			})
+			return
+		}
+		data["name"] = assignee.Name
+		err = app.mailer.Send(assignee.Email, "todo_assigned.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"todo_id": strconv.FormatInt(todoID, 10),
+			})
+		}
+	})
+}
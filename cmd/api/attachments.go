@@ -0,0 +1,296 @@
+// Filename: cmd/api/attachments.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/storage"
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// multipartOverhead is the room an upload's body gets on top of the file
+// for the multipart boundaries and part headers
+const multipartOverhead = 64 << 10
+
+// errFileTooLarge is returned while reading an upload once the file goes
+// over the attachment size limit
+var errFileTooLarge = errors.New("file too large")
+
+// listAttachmentsHandler for the "GET /v1/todo/:id/attachments" endpoint
+// returns the files attached to a todo, oldest first
+func (app *application) listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	todo, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	attachments, err := app.models.Attachments.GetAllForTodo(todo.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"attachments": attachments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createAttachmentHandler for the "POST /v1/todo/:id/attachments" endpoint
+// uploads a file from the "file" part of a multipart/form-data body. The
+// file is streamed into storage rather than read into memory, and its
+// content type is sniffed from its first bytes instead of taken from the
+// client
+func (app *application) createAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	todo, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	maxSize := app.config.storage.maxFileSize
+	// Uploads don't go through readJSON(), so they get their own body limit
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+multipartOverhead)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch {
+		case errors.Is(err, http.ErrNotMultipart) && mediaType != "":
+			app.unsupportedMediaTypeResponse(w, r, mediaType)
+		default:
+			app.badRequestResponse(w, r, errors.New("body must be multipart/form-data"))
+		}
+		return
+	}
+	part, err := readFilePart(mr)
+	if err != nil {
+		app.uploadErrorResponse(w, r, err)
+		return
+	}
+	defer part.Close()
+	user := app.contextGetUser(r)
+	attachment := &data.Attachment{
+		TodoID:     todo.ID,
+		UploaderID: &user.ID,
+		Filename:   cleanFilename(part.FileName()),
+	}
+	v := validator.New()
+	if data.ValidateAttachment(v, attachment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	file := &uploadReader{r: part, max: maxSize}
+	// Sniff the content type from the start of the file
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		app.uploadErrorResponse(w, r, err)
+		return
+	}
+	if n == 0 {
+		v.AddError("file", "must not be empty")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	head = head[:n]
+	attachment.ContentType = http.DetectContentType(head)
+	key, err := storage.NewKey()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	hash := sha256.New()
+	err = app.storage.Put(r.Context(), key, io.TeeReader(io.MultiReader(bytes.NewReader(head), file), hash))
+	if err != nil {
+		// Errors reading the body are the client's, anything else is ours
+		if file.err != nil && !errors.Is(file.err, io.EOF) {
+			app.uploadErrorResponse(w, r, file.err)
+		} else {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	attachment.Size = file.n
+	attachment.Checksum = hex.EncodeToString(hash.Sum(nil))
+	attachment.StorageKey = key
+	err = app.models.Attachments.Insert(attachment)
+	if err != nil {
+		app.deleteStoredFiles([]string{key})
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/todo/%d/attachments/%d", todo.ID, attachment.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"attachment": attachment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showAttachmentHandler for the "GET /v1/todo/:id/attachments/:aid"
+// endpoint downloads an attached file. It is always sent as a download
+// with the sniffed content type, so that browsers don't render it
+func (app *application) showAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := app.readAttachmentParam(w, r)
+	if !ok {
+		return
+	}
+	file, err := app.storage.Open(r.Context(), attachment.StorageKey)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+attachment.Checksum+`"`)
+	w.WriteHeader(http.StatusOK)
+	// The status has been sent, so a failed copy can only be logged
+	if _, err := io.Copy(w, file); err != nil {
+		app.logError(r, err)
+	}
+}
+
+// deleteAttachmentHandler for the "DELETE /v1/todo/:id/attachments/:aid"
+// endpoint removes an attachment and its file
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := app.readAttachmentParam(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Attachments.Delete(attachment.ID, attachment.TodoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.deleteStoredFiles([]string{attachment.StorageKey})
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "attachment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readAttachmentParam() fetches the attachment named by the :aid parameter
+// from the todo named by :id, which is checked by readTodoParam()
+func (app *application) readAttachmentParam(w http.ResponseWriter, r *http.Request) (*data.Attachment, bool) {
+	todo, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return nil, false
+	}
+	attachmentID, err := app.readNamedIDParam(r, "aid")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	attachment, err := app.models.Attachments.Get(attachmentID, todo.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return attachment, true
+}
+
+// uploadErrorResponse() answers an upload whose body couldn't be read
+func (app *application) uploadErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errFileTooLarge), err.Error() == "http: request body too large":
+		app.fileTooLargeResponse(w, r, app.config.storage.maxFileSize)
+	default:
+		app.badRequestResponse(w, r, err)
+	}
+}
+
+// deleteStoredFiles() removes files from storage once nothing refers to
+// them. Failures are logged, as the records are already gone
+func (app *application) deleteStoredFiles(keys []string) {
+	for _, key := range keys {
+		err := app.storage.Delete(context.Background(), key)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"storage_key": key,
+			})
+		}
+	}
+}
+
+// readFilePart() skips ahead to the "file" part of a multipart body
+func readFilePart(mr *multipart.Reader) (*multipart.Part, error) {
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("body must contain a file part")
+			}
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			if part.FileName() == "" {
+				part.Close()
+				return nil, errors.New("the file part must have a filename")
+			}
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// cleanFilename() keeps the last element of an uploaded file's name and
+// drops control characters from it
+func cleanFilename(name string) string {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	return strings.TrimSpace(name)
+}
+
+// uploadReader counts the bytes of a file as they are read, and fails
+// with errFileTooLarge once there are more than max. It remembers the
+// error it last returned
+type uploadReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+	err error
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.n += int64(n)
+	if u.n > u.max {
+		err = errFileTooLarge
+	}
+	u.err = err
+	return n, err
+}
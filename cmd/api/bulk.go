@@ -0,0 +1,305 @@
+// Filename: cmd/api/bulk.go
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/validator"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxBulkOperations caps a batch so that one request can't hold a
+// transaction open for too long
+const maxBulkOperations = 100
+
+// The operations a bulk request can carry
+const (
+	bulkCreate = "create"
+	bulkUpdate = "update"
+	bulkDelete = "delete"
+)
+
+// bulkOperation is one change in a "POST /v1/todo/bulk" request. Todo holds
+// the create body or the update patch
+type bulkOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id"`
+	Version *int32          `json:"version"`
+	Todo    json.RawMessage `json:"todo"`
+}
+
+// bulkResult reports what happened to one operation. Error has the same
+// shape as the "error" of the matching single-todo response
+type bulkResult struct {
+	Index  int         `json:"index"`
+	Op     string      `json:"op"`
+	Status int         `json:"status"`
+	Todo   *data.Todo  `json:"todo,omitempty"`
+	Next   *data.Todo  `json:"next,omitempty"`
+	Error  interface{} `json:"error,omitempty"`
+	// previousAssigneeID is who the todo was assigned to before the
+	// operation, so that a new assignee can be told once it is saved
+	previousAssigneeID *int64
+}
+
+func (result bulkResult) failed() bool {
+	return result.Status >= 400
+}
+
+// bulkTodoHandler for the "POST /v1/todo/bulk" endpoint. httprouter can't
+// register /v1/todo/bulk next to the /v1/todo/:id routes, so the route is
+// matched on the :id segment. By default the batch is applied in one
+// transaction; with "atomic": false each operation stands on its own
+func (app *application) bulkTodoHandler(w http.ResponseWriter, r *http.Request) {
+	// A POST to any other todo isn't a route
+	if httprouter.ParamsFromContext(r.Context()).ByName("id") != "bulk" {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Atomic     *bool           `json:"atomic"`
+		Operations []bulkOperation `json:"operations"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(len(input.Operations) >= 1, "operations", "must contain at least one operation")
+	v.Check(len(input.Operations) <= maxBulkOperations, "operations", fmt.Sprintf("must contain at most %d operations", maxBulkOperations))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	ownerID, err := app.todoOwnerID(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	userID := user.ID
+
+	if input.Atomic != nil && !*input.Atomic {
+		// Per-item mode: every operation is saved on its own and the
+		// failures are reported alongside the successes. The operations
+		// before an unexpected error are already saved, so it is logged
+		// and reported for its operation like any other failure
+		results := make([]bulkResult, len(input.Operations))
+		for i, op := range input.Operations {
+			results[i], err = app.applyBulkOperation(app.todoModel(r), i, op, ownerID, userID)
+			if err != nil {
+				app.logError(r, err)
+				results[i] = bulkResult{
+					Index:  i,
+					Op:     op.Op,
+					Status: http.StatusInternalServerError,
+					Error:  serverErrorMessage,
+				}
+				continue
+			}
+			if !results[i].failed() && results[i].Todo != nil {
+				app.notifyAssignee(results[i].Todo, results[i].previousAssigneeID, user)
+			}
+		}
+		err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Atomic mode: the first failure rolls the whole batch back
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tx, err := app.todoModel(r).BeginTx(ctx)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+	results := make([]bulkResult, 0, len(input.Operations))
+	for i, op := range input.Operations {
+		result, err := app.applyBulkOperation(tx, i, op, ownerID, userID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if result.failed() {
+			app.writeBulkRollback(w, r, input.Operations, result)
+			return
+		}
+		results = append(results, result)
+	}
+	if err = tx.Commit(); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Assignees only hear about todos once the batch is saved
+	for _, result := range results {
+		if result.Todo != nil {
+			app.notifyAssignee(result.Todo, result.previousAssigneeID, user)
+		}
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// writeBulkRollback() reports an atomic batch that was rolled back because
+// of a failure. The response has the failed operation's status, and every
+// other operation is marked as not applied
+func (app *application) writeBulkRollback(w http.ResponseWriter, r *http.Request, ops []bulkOperation, failure bulkResult) {
+	results := make([]bulkResult, len(ops))
+	for i, op := range ops {
+		results[i] = bulkResult{
+			Index:  i,
+			Op:     op.Op,
+			Status: http.StatusFailedDependency,
+			Error:  fmt.Sprintf("not applied because operation %d failed", failure.Index),
+		}
+	}
+	results[failure.Index] = failure
+	err := app.writeJSON(w, failure.Status, envelope{"results": results}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// applyBulkOperation() runs one operation against store and describes the
+// outcome. Only unexpected failures are returned as an error
+func (app *application) applyBulkOperation(store todoStore, index int, op bulkOperation, ownerID, userID int64) (bulkResult, error) {
+	result := bulkResult{Index: index, Op: op.Op}
+	fail := func(status int, message interface{}) (bulkResult, error) {
+		result.Status = status
+		result.Error = message
+		return result, nil
+	}
+	v := validator.New()
+	v.Check(validator.In(op.Op, bulkCreate, bulkUpdate, bulkDelete), "op", "must be one of create, update, delete")
+	if op.Op == bulkUpdate || op.Op == bulkDelete {
+		v.Check(op.ID > 0, "id", "must be provided")
+		v.Check(op.Version != nil, "version", "must be provided")
+	}
+	if op.Op == bulkCreate || op.Op == bulkUpdate {
+		v.Check(len(op.Todo) > 0, "todo", "must be provided")
+	}
+	if !v.Valid() {
+		return fail(http.StatusUnprocessableEntity, v.Errors)
+	}
+
+	if op.Op == bulkCreate {
+		var input todoInput
+		if err := decodeBulkTodo(op.Todo, &input); err != nil {
+			return fail(http.StatusBadRequest, err.Error())
+		}
+		todo := input.todo(userID)
+		if err := app.validateTodoList(v, todo, nil, userID); err != nil {
+			return result, err
+		}
+		if err := app.validateAssignee(v, todo); err != nil {
+			return result, err
+		}
+		if data.ValidateList(v, todo); !v.Valid() {
+			return fail(http.StatusUnprocessableEntity, v.Errors)
+		}
+		if err := store.Insert(todo); err != nil {
+			return result, err
+		}
+		result.Status = http.StatusCreated
+		result.Todo = todo
+		return result, nil
+	}
+
+	// Updates and deletes only apply to the version the client last saw
+	todo, err := store.Get(op.ID, ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return fail(http.StatusNotFound, notFoundMessage)
+		default:
+			return result, err
+		}
+	}
+	if todo.Version != *op.Version {
+		return fail(http.StatusConflict, editConflictMessage)
+	}
+	// Viewers of a shared list can't change its todos
+	canEdit, err := app.canEditTodo(todo, ownerID)
+	if err != nil {
+		return result, err
+	}
+	if !canEdit {
+		return fail(http.StatusForbidden, notPermittedMessage)
+	}
+
+	if op.Op == bulkDelete {
+		err = store.Delete(todo, ownerID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				return fail(http.StatusConflict, editConflictMessage)
+			default:
+				return result, err
+			}
+		}
+		result.Status = http.StatusOK
+		return result, nil
+	}
+
+	var input todoPatch
+	if err := decodeBulkTodo(op.Todo, &input); err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	}
+	previousStatus := todo.Status
+	previousListID := todo.ListID
+	result.previousAssigneeID = todo.AssigneeID
+	if err := input.apply(todo); err != nil {
+		return fail(http.StatusBadRequest, err.Error())
+	}
+	if err := app.validateTodoList(v, todo, previousListID, userID); err != nil {
+		return result, err
+	}
+	if err := app.validateAssignee(v, todo); err != nil {
+		return result, err
+	}
+	if err := app.validateTodoChange(v, store, todo, previousStatus); err != nil {
+		return result, err
+	}
+	if !v.Valid() {
+		return fail(http.StatusUnprocessableEntity, v.Errors)
+	}
+	next, err := app.saveTodo(store, todo, previousStatus, ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return fail(http.StatusConflict, editConflictMessage)
+		default:
+			return result, err
+		}
+	}
+	result.Status = http.StatusOK
+	result.Todo = todo
+	result.Next = next
+	return result, nil
+}
+
+// decodeBulkTodo() decodes the todo of an operation as strictly as
+// readJSON() decodes a request body
+func decodeBulkTodo(raw json.RawMessage, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return fmt.Errorf("todo is badly-formed: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+// Filename: cmd/api/comments.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// listCommentsHandler for the "GET /v1/todo/:id/comments" endpoint returns
+// a page of the discussion on a todo, oldest first
+func (app *application) listCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	todo, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.SortList = []string{"id", "-id"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	comments, metadata, err := app.models.Comments.GetAllForTodo(todo.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"comments": comments, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createCommentHandler for the "POST /v1/todo/:id/comments" endpoint adds
+// a comment written by the user. Anyone who can see the todo can comment
+// on it, including list members who can only view it
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
+	todo, _, ok := app.readViewableTodoParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Body string `json:"body"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	user := app.contextGetUser(r)
+	comment := &data.Comment{
+		TodoID:     todo.ID,
+		AuthorID:   &user.ID,
+		AuthorName: user.Name,
+		Body:       input.Body,
+	}
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Comments.Insert(comment)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/todo/%d/comments/%d", todo.ID, comment.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"comment": comment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCommentHandler for the "PATCH /v1/todo/:id/comments/:cid" endpoint
+// lets the author of a comment change what it says
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, _, _, ok := app.readCommentParam(w, r)
+	if !ok {
+		return
+	}
+	if comment.AuthorID == nil || *comment.AuthorID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	var input struct {
+		Body    string `json:"body"`
+		Version *int32 `json:"version"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Version != nil && *input.Version != comment.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	comment.Body = input.Body
+	v := validator.New()
+	if data.ValidateComment(v, comment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Comments.Update(comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"comment": comment}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCommentHandler for the "DELETE /v1/todo/:id/comments/:cid"
+// endpoint. Authors can delete their comments, and the owner of the todo,
+// an owner of its list or a todo admin can delete any comment on it
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment, todo, ownerID, ok := app.readCommentParam(w, r)
+	if !ok {
+		return
+	}
+	isAuthor := comment.AuthorID != nil && *comment.AuthorID == app.contextGetUser(r).ID
+	if !isAuthor {
+		canModerate, err := app.hasTodoRole(todo, ownerID, data.ListRoleOwner)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !canModerate {
+			app.notPermittedResponse(w, r)
+			return
+		}
+	}
+	err := app.models.Comments.Delete(comment.ID, comment.TodoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "comment successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCommentEditsHandler for the "GET /v1/todo/:id/comments/:cid/edits"
+// endpoint returns what a comment said before each time it was edited
+func (app *application) listCommentEditsHandler(w http.ResponseWriter, r *http.Request) {
+	comment, _, _, ok := app.readCommentParam(w, r)
+	if !ok {
+		return
+	}
+	edits, err := app.models.Comments.GetEdits(comment.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"edits": edits}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readCommentParam() fetches the comment named by the :cid parameter from
+// the todo named by :id. Only seeing the todo is needed, as whoever can see
+// it can comment on it. The handlers check who may change the comment
+func (app *application) readCommentParam(w http.ResponseWriter, r *http.Request) (*data.Comment, *data.Todo, int64, bool) {
+	todo, ownerID, ok := app.readViewableTodoParam(w, r)
+	if !ok {
+		return nil, nil, 0, false
+	}
+	commentID, err := app.readNamedIDParam(r, "cid")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, 0, false
+	}
+	comment, err := app.models.Comments.Get(commentID, todo.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, 0, false
+	}
+	return comment, todo, ownerID, true
+}
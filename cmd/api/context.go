@@ -15,6 +15,12 @@ type contextKey string
 // make user a key
 const userContextKey = contextKey("user")
 
+// make the authentication token a key
+const tokenContextKey = contextKey("token")
+
+// make the list named in the URL a key
+const listContextKey = contextKey("list")
+
 // Method to add user to the context
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -29,3 +35,33 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// Method to add the plaintext authentication token to the context
+func (app *application) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// Retrieve the plaintext authentication token
+func (app *application) contextGetToken(r *http.Request) string {
+	token, ok := r.Context().Value(tokenContextKey).(string)
+	if !ok {
+		panic("missing token value in request context")
+	}
+	return token
+}
+
+// Method to add the list a request is about to the context
+func (app *application) contextSetList(r *http.Request, list *data.List) *http.Request {
+	ctx := context.WithValue(r.Context(), listContextKey, list)
+	return r.WithContext(ctx)
+}
+
+// Retrieve the List struct, which includes the user's role on it
+func (app *application) contextGetList(r *http.Request) *data.List {
+	list, ok := r.Context().Value(listContextKey).(*data.List)
+	if !ok {
+		panic("missing list value in request context")
+	}
+	return list
+}
@@ -0,0 +1,115 @@
+// Filename: cmd/api/dependencies.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// listDependenciesHandler for the "GET /v1/todo/:id/dependencies" endpoint
+// returns the todos blocking a todo and the todos it blocks
+func (app *application) listDependenciesHandler(w http.ResponseWriter, r *http.Request) {
+	todo, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	blockedBy, err := app.models.Todo.GetBlockers(todo.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	blocking, err := app.models.Todo.GetBlocking(todo.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"blocked_by": blockedBy, "blocking": blocking}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createDependencyHandler for the "POST /v1/todo/:id/dependencies" endpoint
+// marks a todo as blocked by another todo of the same owner
+func (app *application) createDependencyHandler(w http.ResponseWriter, r *http.Request) {
+	todo, ownerID, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		BlockedByID int64 `json:"blocked_by_id"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.BlockedByID > 0, "blocked_by_id", "must be provided")
+	v.Check(input.BlockedByID != todo.ID, "blocked_by_id", "must not be the todo itself")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// The blocker has to be a todo the user can see, with the same owner
+	blocker, err := app.models.Todo.Get(input.BlockedByID, ownerID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	v.Check(blocker != nil && blocker.UserID == todo.UserID, "blocked_by_id", "must be an existing todo with the same owner")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Todo.AddDependency(todo.ID, blocker.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDependencyCycle):
+			v.AddError("blocked_by_id", "would create a dependency cycle")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateDependency):
+			v.AddError("blocked_by_id", "already blocks this todo")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"blocked_by": blocker}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteDependencyHandler for the "DELETE /v1/todo/:id/dependencies/:blocker_id"
+// endpoint
+func (app *application) deleteDependencyHandler(w http.ResponseWriter, r *http.Request) {
+	todo, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	blockerID, err := app.readNamedIDParam(r, "blocker_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	err = app.models.Todo.RemoveDependency(todo.ID, blockerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "dependency successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
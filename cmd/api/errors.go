@@ -5,6 +5,15 @@ import (
 	"net/http"
 )
 
+// The messages of the error responses that are also reported per item
+// by the bulk endpoint
+const (
+	notFoundMessage     = "the requested resource could not be found"
+	editConflictMessage = "unable to update the record due to an edit conflict, please try again"
+	notPermittedMessage = "your user account does not have the necessary permissions to access this resource"
+	serverErrorMessage  = "the server encounted a problem and could not process the request"
+)
+
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.PrintError(err, map[string]string{
 		"request_method": r.Method,
@@ -28,14 +37,14 @@ func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Reque
 	// We log the error
 	app.logError(r, err)
 	// Prepare a message with the error
-	message := "the server encounted a problem and could not process the request"
+	message := serverErrorMessage
 	app.errorResponse(w, r, http.StatusInternalServerError, message)
 }
 
 // The not found response
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	// Creat our message
-	message := "the requested resource could not be found"
+	message := notFoundMessage
 	app.errorResponse(w, r, http.StatusNotFound, message)
 }
 
@@ -58,10 +67,28 @@ func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.
 
 // Edit Conflict error
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
-	message := "unable to update the record due to an edit conflict, please try again"
+	message := editConflictMessage
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// The client's copy of the resource is out of date
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has changed since it was last read, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// The request body is in a format that the endpoint does not accept
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, mediaType string) {
+	message := fmt.Sprintf("the %s content type is not supported for this resource", mediaType)
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
+// The uploaded file is bigger than the server accepts
+func (app *application) fileTooLargeResponse(w http.ResponseWriter, r *http.Request, maxSize int64) {
+	message := fmt.Sprintf("the file must not be larger than %d bytes", maxSize)
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
 //Rate limit error
 func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
 	message := "rate limit exceeded"
@@ -95,6 +122,6 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 
 // User does not have the required permission (read/write)
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
-	message := "your user account does not have the necessary permissions to access this resource"
+	message := notPermittedMessage
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
@@ -11,7 +11,9 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
+	"alysianorales.net/TODO/internal/data"
 	"alysianorales.net/TODO/internal/validator"
 	"github.com/julienschmidt/httprouter"
 )
@@ -20,12 +22,17 @@ import (
 type envelope map[string]interface{}
 
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam() reads a positive id from the named URL parameter
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	// Use the "ParamsFromContext()" function to get the request context as a slice
 	params := httprouter.ParamsFromContext(r.Context())
-	// Get the value of the "id" parameter
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	// Get the value of the parameter
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 	return id, nil
 }
@@ -42,6 +49,10 @@ func (app *application) writeJSON(w http.ResponseWriter, status int, data envelo
 	for key, value := range headers {
 		w.Header()[key] = value
 	}
+	// A response carrying a single todo is tagged with its version
+	if todo, ok := envelopeTodo(data); ok && status < 300 && w.Header().Get("ETag") == "" {
+		w.Header().Set("ETag", todoETag(todo))
+	}
 	// Specifiy that we will serve our responses using JSON
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -147,6 +158,83 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return intValue
 }
 
+//the readTime() method parses a date (2006-01-02) or an RFC 3339 timestamp
+//from the query string. If no matching key is found then nil is returned.
+//If the value cannot be parsed then the validation error is added to
+//the validation errors map
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	//Get the value
+	value := qs.Get(key)
+	if value == "" {
+		return nil
+	}
+	//Try each of the accepted layouts
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return &t
+		}
+	}
+	v.AddError(key, "must be a date (2006-01-02) or an RFC 3339 timestamp")
+	return nil
+}
+
+//the readBool() method converts a string value from the query string to a bool.
+//If the value cannot be converted then the validation error is added to
+//the validation errors map
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	//Get the value
+	value := qs.Get(key)
+	if value == "" {
+		return defaultValue
+	}
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return boolValue
+}
+
+// envelopeTodo() returns the todo of an envelope that carries one
+func envelopeTodo(env envelope) (*data.Todo, bool) {
+	todo, ok := env["todo"].(*data.Todo)
+	return todo, ok
+}
+
+// todoETag() returns the entity tag of a todo. It changes whenever the
+// version does
+func todoETag(todo *data.Todo) string {
+	return fmt.Sprintf("\"%d-%d\"", todo.ID, todo.Version)
+}
+
+// etagMatches() reports whether an If-Match or If-None-Match header lists
+// etag. If-None-Match compares weakly, so W/ prefixes are ignored there
+func etagMatches(header string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch() enforces the If-Match header of a request that changes a
+// todo. It sends a 412 Precondition Failed response and returns false when
+// the client's copy of the todo is out of date
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, todo *data.Todo) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || etagMatches(ifMatch, todoETag(todo), false) {
+		return true
+	}
+	app.preconditionFailedResponse(w, r)
+	return false
+}
+
 // background accepts a function as its parameter
 func (app *application) background(fn func()) {
 	// increment the waitGroup counter
@@ -0,0 +1,141 @@
+// Filename: cmd/api/history.go
+
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// listTodoHistoryHandler for the "GET /v1/todo/:id/history" endpoint returns
+// the changes made to a todo, newest first
+func (app *application) listTodoHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	todo, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "-id"
+	input.Filters.SortList = []string{"-id"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	history, metadata, err := app.models.Todo.GetHistory(todo.ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"history": history, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertTodoHandler for the "POST /v1/todo/:id/revert" endpoint puts a
+// todo's editable fields back to how they were at to_version, including its
+// list, assignee and recurrence. The change is saved as a new version, and
+// version must be the todo's current version
+func (app *application) revertTodoHandler(w http.ResponseWriter, r *http.Request) {
+	todo, ownerID, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Version   *int32 `json:"version"`
+		ToVersion int32  `json:"to_version"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(input.Version != nil, "version", "must be provided")
+	v.Check(input.ToVersion > 0, "to_version", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	if *input.Version != todo.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	past, err := app.models.Todo.GetVersion(todo.ID, input.ToVersion)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("to_version", "must be a version in the todo's history")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Every field a PUT would set is reverted, as if the old version had
+	// been sent as the replacement
+	previousStatus := todo.Status
+	previousListID, previousAssigneeID := todo.ListID, todo.AssigneeID
+	todoInput{
+		Title:      past.Title,
+		Label:      past.Label,
+		Task:       past.Task,
+		Priority:   past.Priority,
+		Status:     past.Status,
+		Website:    past.Website,
+		Address:    past.Address,
+		Tags:       past.Tags,
+		DueAt:      past.DueAt,
+		Recurrence: past.Recurrence,
+		ListID:     past.ListID,
+		AssigneeID: past.AssigneeID,
+	}.replace(todo)
+	// A subtask is always in its parent's list, wherever that is now
+	if todo.ParentID != nil {
+		todo.ListID = previousListID
+	}
+	if err := app.validateTodoList(v, todo, previousListID, app.contextGetUser(r).ID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := app.validateAssignee(v, todo); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := app.validateTodoChange(v, app.todoModel(r), todo, previousStatus); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	next, err := app.saveTodo(app.todoModel(r), todo, previousStatus, ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.notifyAssignee(todo, previousAssigneeID, app.contextGetUser(r))
+	env := envelope{"todo": todo}
+	if next != nil {
+		env["next"] = next
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
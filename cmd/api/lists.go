@@ -0,0 +1,331 @@
+// Filename: cmd/api/lists.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// invitationTTL is how long a list invitation can be accepted for
+const invitationTTL = 7 * 24 * time.Hour
+
+// createListHandler for the "POST /v1/lists" endpoint creates a list with
+// the user as its owner
+func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	list := &data.List{
+		Name:        input.Name,
+		Description: input.Description,
+	}
+	v := validator.New()
+	if data.ValidateListDetails(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Lists.Insert(list, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lists/%d", list.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listListsHandler for the "GET /v1/lists" endpoint returns the lists the
+// user is a member of, with their role on each
+func (app *application) listListsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = "name"
+	input.Filters.SortList = []string{"name"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	lists, metadata, err := app.models.Lists.GetAllForUser(app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"lists": lists, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showListHandler for the "GET /v1/lists/:id" endpoint returns a list and
+// its members. The list's todos are listed with "GET /v1/todo?list=:id"
+func (app *application) showListHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.contextGetList(r)
+	members, err := app.models.Lists.GetMembers(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list, "members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateListHandler for the "PATCH /v1/lists/:id" endpoint renames a list
+// or changes its description
+func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.contextGetList(r)
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Name != nil {
+		list.Name = *input.Name
+	}
+	if input.Description != nil {
+		list.Description = *input.Description
+	}
+	v := validator.New()
+	if data.ValidateListDetails(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Lists.Update(list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteListHandler for the "DELETE /v1/lists/:id" endpoint removes a list.
+// Its todos are kept by the people who created them
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.contextGetList(r)
+	err := app.models.Lists.Delete(list.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "list successfully deleted, its todos went back to the people who created them"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listListMembersHandler for the "GET /v1/lists/:id/members" endpoint
+func (app *application) listListMembersHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeListMembers(w, r, app.contextGetList(r))
+}
+
+// updateListMemberHandler for the "PATCH /v1/lists/:id/members/:user_id"
+// endpoint changes the role of a member
+func (app *application) updateListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.contextGetList(r)
+	userID, err := app.readNamedIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	var input struct {
+		Role string `json:"role"`
+	}
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateListRole(v, input.Role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Lists.SetRole(list.ID, userID, input.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLastOwner):
+			v.AddError("role", "the list must keep at least one owner")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	app.writeListMembers(w, r, list)
+}
+
+// deleteListMemberHandler for the "DELETE /v1/lists/:id/members/:user_id"
+// endpoint takes a member off a list. Owners can remove anyone, and every
+// member can remove themselves to leave the list
+func (app *application) deleteListMemberHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.contextGetList(r)
+	userID, err := app.readNamedIDParam(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	if list.Role != data.ListRoleOwner && userID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	err = app.models.Lists.RemoveMember(list.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrLastOwner):
+			v := validator.New()
+			v.AddError("user_id", "the last owner can't leave the list, delete it or make someone else an owner first")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully removed from the list"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// writeListMembers() responds with the current members of a list
+func (app *application) writeListMembers(w http.ResponseWriter, r *http.Request, list *data.List) {
+	members, err := app.models.Lists.GetMembers(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createListInvitationHandler for the "POST /v1/lists/:id/invitations"
+// endpoint emails an invitation to join a list with a role. The address
+// doesn't need an account yet
+func (app *application) createListInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	list := app.contextGetList(r)
+	user := app.contextGetUser(r)
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	data.ValidateEmail(v, input.Email)
+	data.ValidateListRole(v, input.Role)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	invitation, err := app.models.Lists.NewInvitation(list.ID, input.Email, input.Role, user.ID, invitationTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.background(func() {
+		data := map[string]interface{}{
+			"inviterName":     user.Name,
+			"listName":        list.Name,
+			"role":            invitation.Role,
+			"invitationToken": invitation.Plaintext,
+		}
+		err := app.mailer.Send(invitation.Email, "list_invitation.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+	env := envelope{
+		"message":    "an email will be sent to the address containing the invitation",
+		"invitation": invitation,
+	}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// acceptListInvitationHandler for the "PUT /v1/invitations/accepted"
+// endpoint adds the user to the list an invitation was for. The invitation
+// must have been sent to the user's email address
+func (app *application) acceptListInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	listID, err := app.models.Lists.AcceptInvitation(input.TokenPlaintext, user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired invitation token, or it was sent to a different email address")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	list, err := app.models.Lists.Get(listID, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"alysianorales.net/TODO/internal/data"
 	"alysianorales.net/TODO/internal/jsonlog"
 	"alysianorales.net/TODO/internal/mailer"
+	"alysianorales.net/TODO/internal/storage"
 	_ "github.com/lib/pq"
 )
 
@@ -51,17 +52,38 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	tokens struct {
+		accessTTL  time.Duration // lifetime of an authentication token
+		refreshTTL time.Duration // lifetime of a refresh token
+	}
+	cache struct {
+		ttl time.Duration // how long token and permission lookups are reused
+	}
+	reminders struct {
+		enabled  bool
+		interval time.Duration // how often due todos are checked
+		window   time.Duration // how far ahead of the due date owners are emailed
+	}
+	trash struct {
+		retention     time.Duration // how long deleted todos can be restored
+		purgeInterval time.Duration // how often expired todos are purged
+	}
+	storage struct {
+		dir         string // where the local store keeps uploaded files
+		maxFileSize int64  // largest attachment that can be uploaded, in bytes
+	}
 }
 
 // Define an application struct to hold the dependencies for our HTTP handlers, helpers,
 // and middleware. At the moment this only contains a copy of the config struct and a
 // logger, but it will grow to include a lot more as our build progresses.
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config  config
+	logger  *jsonlog.Logger
+	models  data.Models
+	mailer  mailer.Mailer
+	storage storage.Store
+	wg      sync.WaitGroup
 }
 
 func main() {
@@ -93,6 +115,25 @@ func main() {
 		return nil
 	})
 
+	// These are the flags for the token lifetimes
+	flag.DurationVar(&cfg.tokens.accessTTL, "token-access-ttl", 15*time.Minute, "Authentication token lifetime")
+	flag.DurationVar(&cfg.tokens.refreshTTL, "token-refresh-ttl", 30*24*time.Hour, "Refresh token lifetime")
+	// This is the flag for the lookup cache
+	flag.DurationVar(&cfg.cache.ttl, "cache-ttl", 30*time.Second, "Token and permission cache TTL (0 disables the cache)")
+
+	// These are the flags for the due date reminders
+	flag.BoolVar(&cfg.reminders.enabled, "reminder-enabled", true, "Enable due date reminder emails")
+	flag.DurationVar(&cfg.reminders.interval, "reminder-interval", time.Minute, "How often to check for todos falling due")
+	flag.DurationVar(&cfg.reminders.window, "reminder-window", 24*time.Hour, "How long before the due date to send a reminder")
+
+	// These are the flags for the trash
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "How long deleted todos stay in the trash (0 keeps them forever)")
+	flag.DurationVar(&cfg.trash.purgeInterval, "trash-purge-interval", time.Hour, "How often to purge expired todos from the trash")
+
+	// These are the flags for attachment storage
+	flag.StringVar(&cfg.storage.dir, "storage-dir", "./uploads", "Directory for uploaded attachments")
+	flag.Int64Var(&cfg.storage.maxFileSize, "attachment-max-size", 10<<20, "Maximum attachment size in bytes")
+
 	flag.Parse()
 
 	// Initialize a new logger which writes messages to the standard out stream,
@@ -107,14 +148,20 @@ func main() {
 	defer db.Close() //Closes connection pool
 	//Log the successful connection pool
 	logger.PrintInfo("database connection pool established", nil)
+	// Open the store for attachments
+	store, err := storage.NewLocal(cfg.storage.dir)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
 
 	// Declare an instance of the application struct, containing the config struct and
 	// the logger.
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:  cfg,
+		logger:  logger,
+		models:  data.NewModels(db, cfg.cache.ttl),
+		mailer:  mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		storage: store,
 	}
 	//Call app.serve() to start the server
 	err = app.serve()
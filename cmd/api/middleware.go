@@ -123,8 +123,15 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			}
 			return
 		}
-		// Add the user information to the request context
+		// Remember when the session was last used
+		err = app.models.Tokens.Touch(token)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		// Add the user and token information to the request context
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 		// Call the next handler in the chain
 		next.ServeHTTP(w, r)
 	})
@@ -180,6 +187,37 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	return app.requireActivatedUser(fn)
 }
 
+// requireListRole() checks that the user is a member of the list named by
+// the :id parameter with at least the given role, and puts the list in the
+// request context. Users who aren't members get a 404 so that the list's
+// existence isn't given away
+func (app *application) requireListRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+		user := app.contextGetUser(r)
+		list, err := app.models.Lists.Get(id, user.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		if !data.ListRoleAtLeast(list.Role, role) {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		r = app.contextSetList(r, list)
+		next.ServeHTTP(w, r)
+	}
+}
+
 // Enable CORS
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -192,6 +230,8 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 			for i := range app.config.cors.trustedOrigins {
 				if origin == app.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", "*")
+					// Let browsers read the version tag of a todo
+					w.Header().Set("Access-Control-Expose-Headers", "ETag")
 					break
 				}
 			}
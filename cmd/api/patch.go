@@ -0,0 +1,117 @@
+// Filename: cmd/api/patch.go
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/jsonpatch"
+)
+
+// The patch formats that PATCH /v1/todo/:id accepts besides plain JSON
+const (
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+// patchTodo() reads the body of a PATCH request and applies it to the todo.
+// Merge patches and JSON patches are only used when the client names their
+// media type, and are applied to the todo's editable fields as a whole.
+// Any other body, whatever its Content-Type, is read as plain JSON that
+// only touches the fields it names. It returns false once it has written
+// an error response
+func (app *application) patchTodo(w http.ResponseWriter, r *http.Request, todo *data.Todo) bool {
+	// A missing or malformed header is plain JSON too, as it always was
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != mediaTypeMergePatch && mediaType != mediaTypeJSONPatch {
+		var input todoPatch
+		if err := app.readJSON(w, r, &input); err != nil {
+			app.badRequestResponse(w, r, err)
+			return false
+		}
+		if err := input.apply(todo); err != nil {
+			app.badRequestResponse(w, r, err)
+			return false
+		}
+		return true
+	}
+	var patch json.RawMessage
+	if err := app.readJSON(w, r, &patch); err != nil {
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+	doc, err := todoDocument(todo)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+	if mediaType == mediaTypeMergePatch {
+		doc, err = jsonpatch.Merge(doc, patch)
+	} else {
+		doc, err = jsonpatch.Apply(doc, patch)
+	}
+	if err != nil {
+		switch {
+		// A failed test means the todo is not in the state the client expected
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.editConflictResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, fmt.Errorf("unable to apply the patch: %s", err))
+		}
+		return false
+	}
+	input, err := decodeTodoDocument(doc)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return false
+	}
+	input.replace(todo)
+	return true
+}
+
+// todoDocument() returns the editable fields of a todo as the JSON
+// document that patches are applied to
+func todoDocument(todo *data.Todo) ([]byte, error) {
+	return json.Marshal(todoInput{
+		Title:      todo.Title,
+		Label:      todo.Label,
+		Task:       todo.Task,
+		Priority:   todo.Priority,
+		Status:     todo.Status,
+		Website:    todo.Website,
+		Address:    todo.Address,
+		Tags:       todo.Tags,
+		DueAt:      todo.DueAt,
+		Recurrence: todo.Recurrence,
+		ListID:     todo.ListID,
+		AssigneeID: todo.AssigneeID,
+	})
+}
+
+// decodeTodoDocument() reads a patched document back into the editable
+// fields, so a patch that adds any other member is rejected
+func decodeTodoDocument(doc []byte) (todoInput, error) {
+	var input todoInput
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&input)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &unmarshalTypeError) && unmarshalTypeError.Field != "":
+			return input, fmt.Errorf("patched todo contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			return input, fmt.Errorf("patched todo contains unknown key %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		default:
+			return input, errors.New("patched todo must be a JSON object")
+		}
+	}
+	return input, nil
+}
@@ -0,0 +1,55 @@
+// Filename: cmd/api/reminders.go
+
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// runReminders() emails owners about todos that are about to fall due. It
+// checks every reminder interval until ctx is cancelled
+func (app *application) runReminders(ctx context.Context) {
+	ticker := time.NewTicker(app.config.reminders.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.sendReminders()
+		}
+	}
+}
+
+// sendReminders() claims the todos due within the reminder window and
+// mails each owner. A failed email is logged and its reminder unclaimed,
+// so that it is tried again at the next check
+func (app *application) sendReminders() {
+	reminders, err := app.models.Todo.ClaimReminders(app.config.reminders.window)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	for _, reminder := range reminders {
+		data := map[string]interface{}{
+			"name":   reminder.Name,
+			"todoID": reminder.TodoID,
+			"title":  reminder.Title,
+			"dueAt":  reminder.DueAt.Format(time.RFC1123),
+		}
+		err := app.mailer.Send(reminder.Email, "todo_reminder.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"todo_id": strconv.FormatInt(reminder.TodoID, 10),
+			})
+			err = app.models.Todo.UnclaimReminder(reminder.TodoID)
+			if err != nil {
+				app.logger.PrintError(err, map[string]string{
+					"todo_id": strconv.FormatInt(reminder.TodoID, 10),
+				})
+			}
+		}
+	}
+}
@@ -4,6 +4,7 @@ package main
 import (
 	"net/http"
 
+	"alysianorales.net/TODO/internal/data"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -16,12 +17,75 @@ func (app *application) routes() http.Handler {
 	router.HandlerFunc(http.MethodGet, "/v1/todo", app.requirePermission("todo:read", app.listTodoHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/todo", app.requirePermission("todo:write", app.createTodoHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/todo/:id", app.requirePermission("todo:read", app.showTodoHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todo/:id", app.requirePermission("todo:write", app.bulkTodoHandler))
 	//router.HandlerFunc(http.MethodGet, "/v1/stringrandom/:id", app.showRandomString)
 	router.HandlerFunc(http.MethodPatch, "/v1/todo/:id", app.requirePermission("todo:write", app.updateTodoHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/todo/:id", app.requirePermission("todo:write", app.replaceTodoHandler))
 	router.HandlerFunc(http.MethodDelete, "/v1/todo/:id", app.requirePermission("todo:write", app.deleteTodoHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todo/:id/restore", app.requirePermission("todo:write", app.restoreTodoHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todo/:id/history", app.requirePermission("todo:read", app.listTodoHistoryHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todo/:id/revert", app.requirePermission("todo:write", app.revertTodoHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todo/:id/subtasks", app.requirePermission("todo:read", app.listSubtasksHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todo/:id/subtasks", app.requirePermission("todo:write", app.createSubtaskHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todo/:id/checklist", app.requirePermission("todo:write", app.createChecklistItemHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/todo/:id/checklist/:item_id", app.requirePermission("todo:write", app.updateChecklistItemHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/todo/:id/checklist/:item_id", app.requirePermission("todo:write", app.deleteChecklistItemHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todo/:id/dependencies", app.requirePermission("todo:read", app.listDependenciesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todo/:id/dependencies", app.requirePermission("todo:write", app.createDependencyHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/todo/:id/dependencies/:blocker_id", app.requirePermission("todo:write", app.deleteDependencyHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todo/:id/comments", app.requirePermission("todo:read", app.listCommentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todo/:id/comments", app.requirePermission("todo:write", app.createCommentHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/todo/:id/comments/:cid", app.requirePermission("todo:write", app.updateCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/todo/:id/comments/:cid", app.requirePermission("todo:write", app.deleteCommentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todo/:id/comments/:cid/edits", app.requirePermission("todo:read", app.listCommentEditsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todo/:id/attachments", app.requirePermission("todo:read", app.listAttachmentsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/todo/:id/attachments", app.requirePermission("todo:write", app.createAttachmentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/todo/:id/attachments/:aid", app.requirePermission("todo:read", app.showAttachmentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/todo/:id/attachments/:aid", app.requirePermission("todo:write", app.deleteAttachmentHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.requirePermission("todo:read", app.listListsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requirePermission("todo:write", app.createListHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.requirePermission("todo:read", app.requireListRole(data.ListRoleViewer, app.showListHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requirePermission("todo:write", app.requireListRole(data.ListRoleOwner, app.updateListHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requirePermission("todo:write", app.requireListRole(data.ListRoleOwner, app.deleteListHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id/members", app.requirePermission("todo:read", app.requireListRole(data.ListRoleViewer, app.listListMembersHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id/members/:user_id", app.requirePermission("todo:write", app.requireListRole(data.ListRoleOwner, app.updateListMemberHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/members/:user_id", app.requirePermission("todo:read", app.requireListRole(data.ListRoleViewer, app.deleteListMemberHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:id/invitations", app.requirePermission("todo:write", app.requireListRole(data.ListRoleOwner, app.createListInvitationHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/invitations/accepted", app.requirePermission("todo:read", app.acceptListInvitationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tags", app.requirePermission("todo:read", app.listTagsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tags", app.requirePermission("todo:write", app.createTagHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tags/:id", app.requirePermission("todo:read", app.showTagHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/tags/:id", app.requirePermission("todo:write", app.updateTagHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tags/:id", app.requirePermission("todo:write", app.deleteTagHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tags/:id/merge", app.requirePermission("todo:write", app.mergeTagsHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthenticatedUser(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireAuthenticatedUser(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireAuthenticatedUser(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/email", app.requireAuthenticatedUser(app.requestEmailChangeHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireAuthenticatedUser(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/tokens", app.requireAuthenticatedUser(app.listAuthenticationTokensHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens", app.requireAuthenticatedUser(app.deleteAllAuthenticationTokensHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermission("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/permissions", app.requirePermission("users:admin", app.listPermissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.showUserPermissionsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.grantUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions", app.requirePermission("users:admin", app.revokeUserPermissionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requirePermission("users:admin", app.listRolesHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.grantUserRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles", app.requirePermission("users:admin", app.revokeUserRolesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/cache", app.requirePermission("users:admin", app.showCacheStatsHandler))
 
 	return app.recoverPanic(app.enableCORS(app.rateLimit(app.authenticate(router))))
 
@@ -26,6 +26,19 @@ func (app *application) serve() error {
 	}
 	// The Shutdown() function should return its error to this channel
 	shutdownError := make(chan error)
+	// Start the background workers; stopWorkers ends them on shutdown
+	workers, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	if app.config.reminders.enabled {
+		app.background(func() {
+			app.runReminders(workers)
+		})
+	}
+	if app.config.trash.retention > 0 {
+		app.background(func() {
+			app.runTrashPurge(workers)
+		})
+	}
 
 	go func() {
 		// Create a quit/exit channel which carries os.Signal values
@@ -50,6 +63,7 @@ func (app *application) serve() error {
 		app.logger.PrintInfo("Completing background tasks", map[string]string{
 			"addr": srv.Addr,
 		})
+		stopWorkers()
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
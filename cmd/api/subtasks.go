@@ -0,0 +1,174 @@
+// Filename: cmd/api/subtasks.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// listSubtasksHandler for the "GET /v1/todo/:id/subtasks" endpoint returns
+// the child todos and the checklist of a todo
+func (app *application) listSubtasksHandler(w http.ResponseWriter, r *http.Request) {
+	todo, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	subtasks, err := app.models.Todo.GetSubtasks(todo.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	checklist, err := app.models.Checklist.GetAllForTodo(todo.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"subtasks": subtasks, "checklist": checklist}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createSubtaskHandler for the "POST /v1/todo/:id/subtasks" endpoint creates
+// a child todo. The body is the same as for "POST /v1/todo"
+func (app *application) createSubtaskHandler(w http.ResponseWriter, r *http.Request) {
+	parent, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	app.createTodo(w, r, parent)
+}
+
+// createChecklistItemHandler for the "POST /v1/todo/:id/checklist" endpoint
+func (app *application) createChecklistItemHandler(w http.ResponseWriter, r *http.Request) {
+	todo, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Text string `json:"text"`
+		Done bool   `json:"done"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	item := &data.ChecklistItem{
+		TodoID: todo.ID,
+		Text:   input.Text,
+		Done:   input.Done,
+	}
+	v := validator.New()
+	if data.ValidateChecklistItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Checklist.Insert(item)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/todo/%d/checklist/%d", todo.ID, item.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"checklist_item": item}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateChecklistItemHandler for the "PATCH /v1/todo/:id/checklist/:item_id"
+// endpoint renames an item or ticks it off
+func (app *application) updateChecklistItemHandler(w http.ResponseWriter, r *http.Request) {
+	item, ok := app.readChecklistItemParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Text *string `json:"text"`
+		Done *bool   `json:"done"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Text != nil {
+		item.Text = *input.Text
+	}
+	if input.Done != nil {
+		item.Done = *input.Done
+	}
+	v := validator.New()
+	if data.ValidateChecklistItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Checklist.Update(item)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"checklist_item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteChecklistItemHandler for the "DELETE /v1/todo/:id/checklist/:item_id"
+// endpoint
+func (app *application) deleteChecklistItemHandler(w http.ResponseWriter, r *http.Request) {
+	item, ok := app.readChecklistItemParam(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Checklist.Delete(item.ID, item.TodoID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "checklist item successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readChecklistItemParam() fetches the item named by :item_id from the
+// checklist of the todo named by :id
+func (app *application) readChecklistItemParam(w http.ResponseWriter, r *http.Request) (*data.ChecklistItem, bool) {
+	todo, _, ok := app.readTodoParam(w, r)
+	if !ok {
+		return nil, false
+	}
+	itemID, err := app.readNamedIDParam(r, "item_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	item, err := app.models.Checklist.Get(itemID, todo.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return item, true
+}
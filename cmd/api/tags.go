@@ -0,0 +1,242 @@
+// Filename: cmd/api/tags.go
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// listTagsHandler for the "GET /v1/tags" endpoint returns the user's tags
+// with how many todos each is on
+func (app *application) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readString(qs, "sort", "name")
+	input.Filters.SortList = []string{"name", "usage_count", "created_at", "-name", "-usage_count", "-created_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	tags, metadata, err := app.models.Tags.GetAllForUser(app.contextGetUser(r).ID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"tags": tags, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createTagHandler for the "POST /v1/tags" endpoint creates a tag ahead of
+// tagging todos with it. Tagging a todo creates missing tags as well
+func (app *application) createTagHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	tag := &data.Tag{
+		UserID: app.contextGetUser(r).ID,
+		Name:   input.Name,
+		Color:  input.Color,
+	}
+	if tag.Color == "" {
+		tag.Color = data.DefaultTagColor
+	}
+	v := validator.New()
+	if data.ValidateTag(v, tag); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Tags.Insert(tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTag):
+			v.AddError("name", "a tag with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/tags/%d", tag.ID))
+	err = app.writeJSON(w, http.StatusCreated, envelope{"tag": tag}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showTagHandler for the "GET /v1/tags/:id" endpoint
+func (app *application) showTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.readTagParam(w, r)
+	if !ok {
+		return
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateTagHandler for the "PATCH /v1/tags/:id" endpoint renames a tag or
+// changes its colour. Renaming to the name of another tag is refused, as
+// merging them is what's wanted
+func (app *application) updateTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.readTagParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		Name    *string `json:"name"`
+		Color   *string `json:"color"`
+		Version *int32  `json:"version"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if input.Version != nil && *input.Version != tag.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+	if input.Name != nil {
+		tag.Name = *input.Name
+	}
+	if input.Color != nil {
+		tag.Color = *input.Color
+	}
+	v := validator.New()
+	if data.ValidateTag(v, tag); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Tags.Update(tag)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateTag):
+			v.AddError("name", "a tag with this name already exists, merge the tags instead")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteTagHandler for the "DELETE /v1/tags/:id" endpoint removes a tag
+// from every todo it is on
+func (app *application) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.readTagParam(w, r)
+	if !ok {
+		return
+	}
+	err := app.models.Tags.Delete(tag.ID, tag.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "tag successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// mergeTagsHandler for the "POST /v1/tags/:id/merge" endpoint folds other
+// tags into this one. Their todos are tagged with this tag instead, and
+// the merged tags are deleted
+func (app *application) mergeTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tag, ok := app.readTagParam(w, r)
+	if !ok {
+		return
+	}
+	var input struct {
+		TagIDs []int64 `json:"tag_ids"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	v.Check(len(input.TagIDs) >= 1, "tag_ids", "must contain at least one tag")
+	v.Check(len(input.TagIDs) <= 100, "tag_ids", "must not contain more than 100 tags")
+	seen := make(map[int64]bool, len(input.TagIDs))
+	for _, id := range input.TagIDs {
+		v.Check(id != tag.ID, "tag_ids", "must not contain the tag being merged into")
+		v.Check(!seen[id], "tag_ids", "must not contain duplicate tags")
+		seen[id] = true
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	err = app.models.Tags.Merge(tag, input.TagIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("tag_ids", "must only contain your own tags")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Read the tag back for its new usage count
+	tag, err = app.models.Tags.Get(tag.ID, tag.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"tag": tag}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readTagParam() fetches the user's tag named by the :id parameter
+func (app *application) readTagParam(w http.ResponseWriter, r *http.Request) (*data.Tag, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+	tag, err := app.models.Tags.Get(id, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return tag, true
+}
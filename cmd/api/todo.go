@@ -3,6 +3,7 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -10,21 +11,326 @@ import (
 
 	"alysianorales.net/TODO/internal/data"
 	"alysianorales.net/TODO/internal/validator"
+	"github.com/julienschmidt/httprouter"
 )
 
+// todoOwnerID() returns the owner that the todo queries should be scoped to.
+// Users holding the todo:admin permission get 0, which matches every owner
+func (app *application) todoOwnerID(r *http.Request) (int64, error) {
+	user := app.contextGetUser(r)
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	if permissions.Include("todo:admin") {
+		return 0, nil
+	}
+	return user.ID, nil
+}
+
+// todoModel() returns the todo model for changes made by the request's
+// user, so that they are recorded against the user in the todo history
+func (app *application) todoModel(r *http.Request) data.TodoModel {
+	return app.models.Todo.As(app.contextGetUser(r).ID)
+}
+
+// readTodoParam() fetches the todo named by the :id parameter, scoped to
+// what the user may see. It writes the error response itself and returns
+// false when the todo can't be used
+func (app *application) readTodoParam(w http.ResponseWriter, r *http.Request) (*data.Todo, int64, bool) {
+	// List members who can only view a todo get it, but can't change it
+	return app.readTodo(w, r, r.Method != http.MethodGet && r.Method != http.MethodHead)
+}
+
+// readViewableTodoParam() is readTodoParam() for requests that only need
+// to see the todo, whatever their method
+func (app *application) readViewableTodoParam(w http.ResponseWriter, r *http.Request) (*data.Todo, int64, bool) {
+	return app.readTodo(w, r, false)
+}
+
+// readTodo() fetches the todo for readTodoParam(), and checks that the
+// user may change it when edit is set
+func (app *application) readTodo(w http.ResponseWriter, r *http.Request, edit bool) (*data.Todo, int64, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, 0, false
+	}
+	ownerID, err := app.todoOwnerID(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, 0, false
+	}
+	todo, err := app.models.Todo.Get(id, ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, 0, false
+	}
+	if edit {
+		ok, err := app.canEditTodo(todo, ownerID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return nil, 0, false
+		}
+		if !ok {
+			app.notPermittedResponse(w, r)
+			return nil, 0, false
+		}
+	}
+	return todo, ownerID, true
+}
+
+// canEditTodo() reports whether the user that ownerID stands for may change
+// a todo. Todo admins and the todo's owner always can, and anyone else has
+// to be an editor or owner of the list it is in
+func (app *application) canEditTodo(todo *data.Todo, ownerID int64) (bool, error) {
+	return app.hasTodoRole(todo, ownerID, data.ListRoleEditor)
+}
+
+// hasTodoRole() reports whether the user that ownerID stands for is a todo
+// admin, the todo's owner, or holds at least role in the list it is in
+func (app *application) hasTodoRole(todo *data.Todo, ownerID int64, role string) (bool, error) {
+	if ownerID == 0 || todo.UserID == ownerID {
+		return true, nil
+	}
+	if todo.ListID == nil {
+		return false, nil
+	}
+	held, err := app.models.Lists.GetRole(*todo.ListID, ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+	return data.ListRoleAtLeast(held, role), nil
+}
+
 //createTodoHandler for the "POST /v1/todo" endpoint
 func (app *application) createTodoHandler(w http.ResponseWriter, r *http.Request) {
-	// Our Target Decode destination
-	var input struct {
-		Title    string   `json:"title"`
-		Label    string   `json:"label"`
-		Task     string   `json:"task"`
-		Priority string   `json:"priority"`
-		Status   string   `json:"status"`
-		Website  string   `json:"website"`
-		Address  string   `json:"address"`
-		Mode     []string `json:"mode"`
+	app.createTodo(w, r, nil)
+}
+
+// todoInput is the body of a request that creates or replaces a todo
+type todoInput struct {
+	Title      string           `json:"title"`
+	Label      string           `json:"label"`
+	Task       string           `json:"task"`
+	Priority   string           `json:"priority"`
+	Status     string           `json:"status"`
+	Website    string           `json:"website"`
+	Address    string           `json:"address"`
+	Tags       []string         `json:"tags"`
+	DueAt      *time.Time       `json:"due_at"`
+	Recurrence *data.Recurrence `json:"recurrence"`
+	ListID     *int64           `json:"list_id"`
+	AssigneeID *int64           `json:"assignee_id"`
+}
+
+// The todo() method copies the input into a new todo owned by userID
+func (input todoInput) todo(userID int64) *data.Todo {
+	todo := &data.Todo{
+		ID:         0,
+		CreatedAt:  time.Time{},
+		Title:      input.Title,
+		Label:      input.Label,
+		Task:       input.Task,
+		Priority:   input.Priority,
+		Status:     input.Status,
+		Website:    input.Website,
+		Address:    input.Address,
+		Tags:       input.Tags,
+		DueAt:      input.DueAt,
+		Version:    0,
+		Recurrence: input.Recurrence,
+		UserID:     userID,
+		ListID:     input.ListID,
+		AssigneeID: input.AssigneeID,
+	}
+	// A new series starts at its first occurrence
+	if todo.Recurrence != nil {
+		todo.Recurrence.Occurrence = 1
+	}
+	return todo
+}
+
+// replace() overwrites every editable field of an existing todo. Fields
+// left out of the input are cleared rather than kept
+func (input todoInput) replace(todo *data.Todo) {
+	// The position in the series is kept when the rule is replaced
+	if input.Recurrence != nil {
+		input.Recurrence.Occurrence = 1
+		if todo.Recurrence != nil {
+			input.Recurrence.Occurrence = todo.Recurrence.Occurrence
+		}
+	}
+	todo.Title = input.Title
+	todo.Label = input.Label
+	todo.Task = input.Task
+	todo.Priority = input.Priority
+	todo.Status = input.Status
+	todo.Website = input.Website
+	todo.Address = input.Address
+	todo.Tags = input.Tags
+	todo.DueAt = input.DueAt
+	todo.Recurrence = input.Recurrence
+	todo.ListID = input.ListID
+	todo.AssigneeID = input.AssigneeID
+}
+
+// todoPatch is the body of a request that edits part of a todo.
+//We use pointers because pointers have a default value of nil.
+//If a field remains nil, then we know that the client did not update it
+type todoPatch struct {
+	Title    *string  `json:"title"`
+	Label    *string  `json:"label"`
+	Task     *string  `json:"task"`
+	Priority *string  `json:"priority"`
+	Status   *string  `json:"status"`
+	Website  *string  `json:"website"`
+	Address  *string  `json:"address"`
+	Tags     []string `json:"tags"`
+	// DueAt is raw so that an explicit null can clear the due date
+	DueAt json.RawMessage `json:"due_at"`
+	// Recurrence is raw for the same reason
+	Recurrence json.RawMessage `json:"recurrence"`
+	// ListID is raw so that null can take the todo out of its list
+	ListID json.RawMessage `json:"list_id"`
+	// AssigneeID is raw so that null can unassign the todo
+	AssigneeID json.RawMessage `json:"assignee_id"`
+}
+
+// The apply() method copies the fields that were sent onto the todo
+func (input todoPatch) apply(todo *data.Todo) error {
+	if input.Title != nil {
+		todo.Title = *input.Title
+	}
+	if input.Label != nil {
+		todo.Label = *input.Label
+	}
+	if input.Task != nil {
+		todo.Task = *input.Task
+	}
+	if input.Priority != nil {
+		todo.Priority = *input.Priority
+	}
+	if input.Status != nil {
+		todo.Status = *input.Status
+	}
+	if input.Website != nil {
+		todo.Website = *input.Website
+	}
+	if input.Address != nil {
+		todo.Address = *input.Address
 	}
+	if input.Tags != nil {
+		todo.Tags = input.Tags
+	}
+	if input.DueAt != nil {
+		var dueAt *time.Time
+		if err := json.Unmarshal(input.DueAt, &dueAt); err != nil {
+			return errors.New("body contains incorrect JSON type for \"due_at\"")
+		}
+		todo.DueAt = dueAt
+	}
+	if input.Recurrence != nil {
+		var recurrence *data.Recurrence
+		if err := json.Unmarshal(input.Recurrence, &recurrence); err != nil {
+			return errors.New("body contains badly-formed JSON for \"recurrence\"")
+		}
+		// The position in the series is kept when the rule is replaced
+		if recurrence != nil {
+			recurrence.Occurrence = 1
+			if todo.Recurrence != nil {
+				recurrence.Occurrence = todo.Recurrence.Occurrence
+			}
+		}
+		todo.Recurrence = recurrence
+	}
+	if input.ListID != nil {
+		var listID *int64
+		if err := json.Unmarshal(input.ListID, &listID); err != nil {
+			return errors.New("body contains incorrect JSON type for \"list_id\"")
+		}
+		todo.ListID = listID
+	}
+	if input.AssigneeID != nil {
+		var assigneeID *int64
+		if err := json.Unmarshal(input.AssigneeID, &assigneeID); err != nil {
+			return errors.New("body contains incorrect JSON type for \"assignee_id\"")
+		}
+		todo.AssigneeID = assigneeID
+	}
+	return nil
+}
+
+// todoStore is satisfied by data.TodoModel and by *data.TodoTx, so that
+// changes can be saved on their own or as part of a batch
+type todoStore interface {
+	Insert(todo *data.Todo) error
+	Get(id int64, ownerID int64) (*data.Todo, error)
+	Update(todo *data.Todo, ownerID int64) error
+	CompleteRecurring(todo *data.Todo, ownerID int64) (*data.Todo, error)
+	OpenBlockers(todoID int64) (int, error)
+	Delete(todo *data.Todo, ownerID int64) error
+}
+
+// validateTodoChange() checks an edited todo, including the move from its
+// previous status
+func (app *application) validateTodoChange(v *validator.Validator, store todoStore, todo *data.Todo, previousStatus string) error {
+	data.ValidateList(v, todo)
+	data.ValidateStatusTransition(v, previousStatus, todo.Status)
+	// A todo can't be done while the todos blocking it are still open
+	if todo.Status == data.StatusDone && previousStatus != data.StatusDone {
+		open, err := store.OpenBlockers(todo.ID)
+		if err != nil {
+			return err
+		}
+		v.Check(open == 0, "status", fmt.Sprintf("cannot be done while blocked by %d open todos", open))
+	}
+	return nil
+}
+
+// validateTodoList() checks a todo that is put in a list or moved between
+// lists. The user has to be an editor of the list the todo goes to, and
+// subtasks stay in their parent's list
+func (app *application) validateTodoList(v *validator.Validator, todo *data.Todo, previousListID *int64, userID int64) error {
+	if data.SameList(todo.ListID, previousListID) || todo.ListID == nil && todo.ParentID == nil {
+		return nil
+	}
+	if todo.ParentID != nil {
+		v.AddError("list_id", "cannot be changed on a subtask, move its parent instead")
+		return nil
+	}
+	role, err := app.models.Lists.GetRole(*todo.ListID, userID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return err
+	}
+	v.Check(data.ListRoleAtLeast(role, data.ListRoleEditor), "list_id", "must be a list you can edit")
+	return nil
+}
+
+// saveTodo() stores an edited todo. Completing a recurring todo creates the
+// next one in its series, which is returned; anything else is a plain update
+func (app *application) saveTodo(store todoStore, todo *data.Todo, previousStatus string, ownerID int64) (*data.Todo, error) {
+	if todo.Recurrence != nil && todo.Status == data.StatusDone && previousStatus != data.StatusDone {
+		return store.CompleteRecurring(todo, ownerID)
+	}
+	return nil, store.Update(todo, ownerID)
+}
+
+// createTodo() creates a todo from the request body. A todo with a parent
+// is a subtask and belongs to the parent's owner
+func (app *application) createTodo(w http.ResponseWriter, r *http.Request, parent *data.Todo) {
+	// Our Target Decode destination
+	var input todoInput
 	// Initialize a new json.
 	err := app.readJSON(w, r, &input)
 	if err != nil {
@@ -32,22 +338,28 @@ func (app *application) createTodoHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	//Copy the values from the input struct to a new Todo Struct
-	todo := &data.Todo{
-		ID:        0,
-		CreatedAt: time.Time{},
-		Title:     input.Title,
-		Label:     input.Label,
-		Task:      input.Task,
-		Priority:  input.Priority,
-		Status:    input.Status,
-		Website:   input.Website,
-		Address:   input.Address,
-		Mode:      input.Mode,
-		Version:   0,
+	user := app.contextGetUser(r)
+	todo := input.todo(user.ID)
+	// Subtasks live in their parent's list
+	if parent != nil {
+		todo.ParentID = &parent.ID
+		todo.UserID = parent.UserID
+		todo.ListID = parent.ListID
 	}
 
 	// Initialize a new Validator instance
 	v := validator.New()
+	// A todo can only be put in a list the user can edit
+	if parent == nil {
+		if err := app.validateTodoList(v, todo, nil, user.ID); err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	if err := app.validateAssignee(v, todo); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
 	// check the map to see if there were validation errors
 	if data.ValidateList(v, todo); !v.Valid() {
@@ -55,10 +367,12 @@ func (app *application) createTodoHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 	// Create a Todo
-	err = app.models.Todo.Insert(todo)
+	err = app.todoModel(r).Insert(todo)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
+	app.notifyAssignee(todo, nil, user)
 	// Create a Location header for the newly created resource/List
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/todo/%d", todo.ID))
@@ -72,6 +386,11 @@ func (app *application) createTodoHandler(w http.ResponseWriter, r *http.Request
 
 //showTodoHandler for the "GET /v1/todo/:id" endpoint
 func (app *application) showTodoHandler(w http.ResponseWriter, r *http.Request) {
+	// "GET /v1/todo/trash" shares this route
+	if httprouter.ParamsFromContext(r.Context()).ByName("id") == "trash" {
+		app.listTrashHandler(w, r)
+		return
+	}
 	// Get the value of the "id" parameter
 	id, err := app.readIDParam(r)
 	if err != nil {
@@ -79,8 +398,14 @@ func (app *application) showTodoHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Only the owner (or a todo admin) may see the List
+	ownerID, err := app.todoOwnerID(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 	// Fetch the specific List
-	todo, err := app.models.Todo.Get(id)
+	todo, err := app.models.Todo.Get(id, ownerID)
 	//Handle errors
 	if err != nil {
 		switch {
@@ -91,6 +416,13 @@ func (app *application) showTodoHandler(w http.ResponseWriter, r *http.Request)
 		}
 		return
 	}
+	// The client already has this version
+	etag := todoETag(todo)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	//Write the data returned by Get()
 	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todo}, nil)
 	if err != nil {
@@ -123,81 +455,118 @@ func (app *application) showTodoHandler(w http.ResponseWriter, r *http.Request)
 
 func (app *application) updateTodoHandler(w http.ResponseWriter, r *http.Request) {
 	//This method does a partial replacement
-	//Get the id for the List that needs updating
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
+	//Fetch the List that needs updating. Only the owner (or a todo admin) may edit it
+	todo, ownerID, ok := app.readTodoParam(w, r)
+	if !ok {
 		return
 	}
-	//Fetch the original record from the database
-	todo, err := app.models.Todo.Get(id)
-	//Handle errors
+	// The client's copy has to be current when it sends If-Match
+	if !app.checkIfMatch(w, r, todo) {
+		return
+	}
+	// Remember the status so that the transition and blockers can be checked
+	previousStatus := todo.Status
+	previousListID, previousAssigneeID := todo.ListID, todo.AssigneeID
+	//Apply the changes in whichever patch format the client sent
+	if !app.patchTodo(w, r, todo) {
+		return
+	}
+	//Perform validation on the updated Todo.
+	//If validation fails, then send a 422 - Unprocessable Entity response to the client
+	// Initialize a new Validator instance
+	v := validator.New()
+	if err := app.validateTodoList(v, todo, previousListID, app.contextGetUser(r).ID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if err := app.validateAssignee(v, todo); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// check the map to see if there were validation errors
+	if err := app.validateTodoChange(v, app.todoModel(r), todo, previousStatus); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Pass the updated Todo record on to be saved
+	next, err := app.saveTodo(app.todoModel(r), todo, previousStatus, ownerID)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
-	// Create an input struct to hold data read in from the client
-	//We update the input struct to use pointers because pointers
-	//have a default value of nil
-	//If a field remains nil, then we know that the client
-	//did not update it
-	var input struct {
-		Title    *string  `json:"title"`
-		Label    *string  `json:"label"`
-		Task     *string  `json:"task"`
-		Priority *string  `json:"priority"`
-		Status   *string  `json:"status"`
-		Website  *string  `json:"website"`
-		Address  *string  `json:"address"`
-		Mode     []string `json:"mode"`
+	app.notifyAssignee(todo, previousAssigneeID, app.contextGetUser(r))
+	//Write the updated todo, along with the next one in its series
+	env := envelope{"todo": todo}
+	if next != nil {
+		env["next"] = next
 	}
-	// Initialize a new json.
-	err = app.readJSON(w, r, &input)
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
+// replaceTodoHandler for the "PUT /v1/todo/:id" endpoint replaces every
+// editable field of a todo. Fields that are left out are cleared
+func (app *application) replaceTodoHandler(w http.ResponseWriter, r *http.Request) {
+	todo, ownerID, ok := app.readTodoParam(w, r)
+	if !ok {
 		return
 	}
-	//Check for updates
-	if input.Title != nil {
-		todo.Title = *input.Title
+	if !app.checkIfMatch(w, r, todo) {
+		return
 	}
-	if input.Label != nil {
-		todo.Label = *input.Label
+	var input struct {
+		todoInput
+		// Version or If-Match is required, as a replacement built from a
+		// stale copy would wipe out the changes made since
+		Version *int32 `json:"version"`
 	}
-	if input.Task != nil {
-		todo.Task = *input.Task
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
-	if input.Priority != nil {
-		todo.Priority = *input.Priority
+	v := validator.New()
+	if input.Version == nil && r.Header.Get("If-Match") == "" {
+		v.AddError("version", "must be provided unless the request has an If-Match header")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
 	}
-	if input.Status != nil {
-		todo.Status = *input.Status
+	if input.Version != nil && *input.Version != todo.Version {
+		app.editConflictResponse(w, r)
+		return
 	}
-	if input.Website != nil {
-		todo.Website = *input.Website
+	previousStatus := todo.Status
+	previousListID, previousAssigneeID := todo.ListID, todo.AssigneeID
+	input.todoInput.replace(todo)
+	if err := app.validateTodoList(v, todo, previousListID, app.contextGetUser(r).ID); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
-	if input.Address != nil {
-		todo.Address = *input.Address
+	if err := app.validateAssignee(v, todo); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
-	if input.Mode != nil {
-		todo.Mode = input.Mode
+	if err := app.validateTodoChange(v, app.todoModel(r), todo, previousStatus); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
-	//Perform validation on the updated Todo.
-	//If validation fails, then send a 422 - Unprocessable Entity response to the client
-	// Initialize a new Validator instance
-	v := validator.New()
-	// check the map to see if there were validation errors
-	if data.ValidateList(v, todo); !v.Valid() {
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	// Pass the updates Todo record to the Update() method
-	err = app.models.Todo.Update(todo)
+	next, err := app.saveTodo(app.todoModel(r), todo, previousStatus, ownerID)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -207,34 +576,42 @@ func (app *application) updateTodoHandler(w http.ResponseWriter, r *http.Request
 		}
 		return
 	}
-	//Write the data returned by Get()
-	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todo}, nil)
+	app.notifyAssignee(todo, previousAssigneeID, app.contextGetUser(r))
+	env := envelope{"todo": todo}
+	if next != nil {
+		env["next"] = next
+	}
+	err = app.writeJSON(w, http.StatusOK, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
-
 }
 
 func (app *application) deleteTodoHandler(w http.ResponseWriter, r *http.Request) {
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
+	//Fetch the List. Send a 404 Not Found status code to the client if there
+	//is no matching record. Only the owner, an editor of its list or a todo
+	//admin may delete it
+	todo, ownerID, ok := app.readTodoParam(w, r)
+	if !ok {
+		return
+	}
+	// The client's copy has to be current when it sends If-Match
+	if !app.checkIfMatch(w, r, todo) {
 		return
 	}
-	//Delete the List from the database. Send a 404 Not Found status code
-	//to the client if there is no matching record
-	err = app.models.Todo.Delete(id)
+	//Move the List to the trash
+	err := app.todoModel(r).Delete(todo, ownerID)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 	// Return 200 Status OK to the client with a success message
-	err = app.writeJSON(w, http.StatusOK, envelope{"message": "List successfully deleted"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "List successfully moved to the trash"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -246,9 +623,7 @@ func (app *application) deleteTodoHandler(w http.ResponseWriter, r *http.Request
 func (app *application) listTodoHandler(w http.ResponseWriter, r *http.Request) {
 	//Create an input struct to hold our query parameters
 	var input struct {
-		Title string
-		Label string
-		Mode  []string
+		data.TodoSearch
 		data.Filters
 	}
 	//Initialize a validator
@@ -258,21 +633,51 @@ func (app *application) listTodoHandler(w http.ResponseWriter, r *http.Request)
 	//Use the helper methods to extract the values
 	input.Title = app.readString(qs, "title", "")
 	input.Label = app.readString(qs, "label", "")
-	input.Mode = app.readCSV(qs, "mode", []string{})
+	input.Address = app.readString(qs, "address", "")
+	input.Status = app.readString(qs, "status", "")
+	input.Priority = app.readString(qs, "priority", "")
+	input.Tags = app.readCSV(qs, "tags", []string{})
+	input.TagMatch = app.readString(qs, "tag_match", data.TagMatchAll)
+	input.CreatedAfter = app.readTime(qs, "created_after", v)
+	input.CreatedBefore = app.readTime(qs, "created_before", v)
+	input.DueBefore = app.readTime(qs, "due_before", v)
+	input.Overdue = app.readBool(qs, "overdue", false, v)
+	input.Query = app.readString(qs, "q", "")
+	input.ListID = int64(app.readInt(qs, "list", 0, v))
+	input.AssigneeID = app.readAssignee(qs, app.contextGetUser(r).ID, v)
 	//Get the page information
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
-	//Get the sort information
-	input.Filters.Sort = app.readString(qs, "sort", "id")
+	//Get the cursor for keyset pagination
+	input.Filters.Cursor = app.readString(qs, "cursor", "")
+	//Get the sort information. A full-text search is ranked by relevance
+	//unless the client asks for something else
+	defaultSort := "id"
+	if input.Query != "" {
+		defaultSort = "-relevance"
+	}
+	input.Filters.Sort = app.readString(qs, "sort", defaultSort)
 	//Specify the allowed sort values
-	input.Filters.SortList = []string{"id", "title", "label", "-id", "-title", "-label"}
+	input.Filters.SortList = []string{
+		"id", "title", "label", "task", "status", "priority", "created_at", "updated_at", "due_at",
+		"-id", "-title", "-label", "-task", "-status", "-priority", "-created_at", "-updated_at", "-due_at",
+		"-relevance",
+	}
 	//Check for validation errors
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+	data.ValidateFilters(v, input.Filters)
+	if data.ValidateTodoSearch(v, input.TodoSearch, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	// Limit the listing to the Lists the user owns or shares
+	ownerID, err := app.todoOwnerID(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	input.OwnerID = ownerID
 	//Get a listing of all Lists
-	todos, metadata, err := app.models.Todo.GetAll(input.Title, input.Label, input.Mode, input.Filters)
+	todos, metadata, err := app.models.Todo.GetAll(input.TodoSearch, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
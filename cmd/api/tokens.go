@@ -2,8 +2,11 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"alysianorales.net/TODO/internal/data"
@@ -52,15 +55,213 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 	// Password is correct, so we will generate a authentication token
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	// and the refresh token that starts a new token family
+	token, refreshToken, err := app.models.Tokens.NewPair(user.ID, app.config.tokens.accessTTL, app.config.tokens.refreshTTL, r.UserAgent())
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	// Return the authentication token to the client
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	// Return the tokens to the client
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token, "refresh_token": refreshToken}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 
 }
+
+// refreshAuthenticationTokenHandler exchanges a refresh token for a new
+// authentication token and a new refresh token. Each refresh token can only be
+// used once; replaying one revokes every token in its family
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Get the owner of the refresh token
+	user, err := app.models.Users.GetForToken(data.ScopeRefresh, input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Spend the refresh token and issue its successors in the same family
+	token, refreshToken, err := app.models.Tokens.Refresh(input.RefreshToken, app.config.tokens.accessTTL, app.config.tokens.refreshTTL, r.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTokenReused):
+			app.logger.PrintInfo("refresh token reused, token family revoked", map[string]string{
+				"user_id": strconv.FormatInt(user.ID, 10),
+			})
+			app.invalidAuthenticationTokenResponse(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token, "refresh_token": refreshToken}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAuthenticationTokenHandler logs the user out by revoking the token
+// that was used to authenticate the request, along with its refresh token
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Tokens.Delete(app.contextGetToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listAuthenticationTokensHandler shows the user's active sessions
+func (app *application) listAuthenticationTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	tokens, err := app.models.Tokens.GetAllForUser(data.ScopeAuthentication, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	// Flag the session making this request
+	currentHash := sha256.Sum256([]byte(app.contextGetToken(r)))
+	for _, token := range tokens {
+		token.Current = bytes.Equal(token.Hash, currentHash[:])
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"tokens": tokens}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAllAuthenticationTokensHandler revokes every session of the user
+func (app *application) deleteAllAuthenticationTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	for _, scope := range []string{data.ScopeAuthentication, data.ScopeRefresh} {
+		err := app.models.Tokens.DeleteAllForUsers(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"message": "all sessions have been revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createPasswordResetTokenHandler emails a password reset token to the user.
+// The response is the same whether or not the email belongs to an account
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Only send a token to activated accounts that exist
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if user != nil && user.Activated {
+		token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.background(func() {
+			data := map[string]interface{}{
+				"passwordResetToken": token.Plaintext,
+			}
+			err := app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+	env := envelope{"message": "if an account with that email address exists, you will receive password reset instructions shortly"}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createActivationTokenHandler sends a fresh activation token to a user
+// whose welcome email was lost or whose token has expired. The response is
+// the same whether or not the email belongs to an account awaiting
+// activation
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	v := validator.New()
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	// Only send a token to accounts that exist and aren't yet active
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if user != nil && !user.Activated {
+		// Only the newest activation token should work
+		err = app.models.Tokens.DeleteAllForUsers(data.ScopeActivation, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		token, err := app.models.Tokens.New(user.ID, 1*24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.background(func() {
+			data := map[string]interface{}{
+				"activationToken": token.Plaintext,
+			}
+			err := app.mailer.Send(user.Email, "token_activation.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+	env := envelope{"message": "if an account with that email address is awaiting activation, you will receive activation instructions shortly"}
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
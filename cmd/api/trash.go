@@ -0,0 +1,143 @@
+// Filename: cmd/api/trash.go
+
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"alysianorales.net/TODO/internal/data"
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// listTrashHandler for the "GET /v1/todo/trash" endpoint. httprouter can't
+// register it next to "GET /v1/todo/:id", so showTodoHandler passes the
+// request on
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		data.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	// The trash is always newest first
+	input.Filters.Sort = "-deleted_at"
+	input.Filters.SortList = []string{"-deleted_at"}
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	ownerID, err := app.todoOwnerID(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	todos, metadata, err := app.models.Todo.GetTrash(ownerID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todos, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreTodoHandler for the "POST /v1/todo/:id/restore" endpoint
+func (app *application) restoreTodoHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	ownerID, err := app.todoOwnerID(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	todo, err := app.models.Todo.GetTrashed(id, ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	// Viewers of a shared list can't bring its todos back
+	canEdit, err := app.canEditTodo(todo, ownerID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !canEdit {
+		app.notPermittedResponse(w, r)
+		return
+	}
+	// A subtask can't come back while its parent is still in the trash,
+	// or the purge would take it away again with the parent
+	if todo.ParentID != nil {
+		_, err := app.models.Todo.Get(*todo.ParentID, 0)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v := validator.New()
+				v.AddError("parent_id", "must be restored first")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+	}
+	err = app.todoModel(r).Restore(todo.ID, ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	todo, err = app.models.Todo.Get(todo.ID, ownerID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	err = app.writeJSON(w, http.StatusOK, envelope{"todo": todo}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runTrashPurge() permanently deletes todos once they have been in the
+// trash for the retention period. It checks every purge interval until ctx
+// is cancelled
+func (app *application) runTrashPurge(ctx context.Context) {
+	ticker := time.NewTicker(app.config.trash.purgeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, keys, err := app.models.Todo.PurgeTrash(app.config.trash.retention)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+				continue
+			}
+			app.deleteStoredFiles(keys)
+			if purged > 0 {
+				app.logger.PrintInfo("purged trashed todos", map[string]string{
+					"count": strconv.FormatInt(purged, 10),
+				})
+			}
+		}
+	}
+}
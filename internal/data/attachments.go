@@ -0,0 +1,181 @@
+// Filename: internal/data/attachments.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// An Attachment describes a file uploaded to a todo. The file itself is in
+// storage under StorageKey, which clients never see
+type Attachment struct {
+	ID          int64     `json:"id"`
+	TodoID      int64     `json:"todo_id"`
+	UploaderID  *int64    `json:"uploader_id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"`
+	StorageKey  string    `json:"-"`
+}
+
+func ValidateAttachment(v *validator.Validator, attachment *Attachment) {
+	v.Check(attachment.Filename != "", "filename", "must be provided")
+	v.Check(len(attachment.Filename) <= 255, "filename", "must not be more than 255 bytes long")
+}
+
+type AttachmentModel struct {
+	DB *sql.DB
+}
+
+const attachmentColumns = `id, todo_id, user_id, created_at, filename, content_type, size, checksum, storage_key`
+
+func attachmentDestinations(attachment *Attachment) []interface{} {
+	return []interface{}{
+		&attachment.ID,
+		&attachment.TodoID,
+		&attachment.UploaderID,
+		&attachment.CreatedAt,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.Checksum,
+		&attachment.StorageKey,
+	}
+}
+
+// Insert() records a file that has been put in storage
+func (m AttachmentModel) Insert(attachment *Attachment) error {
+	query := `
+		INSERT INTO todo_attachments (todo_id, user_id, filename, content_type, size, checksum, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	args := []interface{}{
+		attachment.TodoID,
+		attachment.UploaderID,
+		attachment.Filename,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.Checksum,
+		attachment.StorageKey,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&attachment.ID, &attachment.CreatedAt)
+}
+
+// Get() returns an attachment of a todo
+func (m AttachmentModel) Get(id int64, todoID int64) (*Attachment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM todo_attachments
+		WHERE id = $1
+		AND todo_id = $2
+	`
+	var attachment Attachment
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, todoID).Scan(attachmentDestinations(&attachment)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &attachment, nil
+}
+
+// GetAllForTodo() returns the attachments of a todo, oldest first
+func (m AttachmentModel) GetAllForTodo(todoID int64) ([]*Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM todo_attachments
+		WHERE todo_id = $1
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	attachments := []*Attachment{}
+	for rows.Next() {
+		var attachment Attachment
+		if err := rows.Scan(attachmentDestinations(&attachment)...); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, &attachment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// Delete() removes the record of an attachment. The caller deletes the
+// file from storage
+func (m AttachmentModel) Delete(id int64, todoID int64) error {
+	query := `
+		DELETE FROM todo_attachments
+		WHERE id = $1
+		AND todo_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, todoID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetStorageKeysForUser() returns where the files attached to a user's
+// todos are stored, so that they can be deleted along with the account
+func (m AttachmentModel) GetStorageKeysForUser(userID int64) ([]string, error) {
+	query := `
+		SELECT todo_attachments.storage_key
+		FROM todo_attachments
+		INNER JOIN todo ON todo.id = todo_attachments.todo_id
+		WHERE todo.user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
@@ -0,0 +1,204 @@
+// Filename: internal/data/cache.go
+
+package data
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache keeps recently resolved authentication tokens and permission sets
+// in memory so that authenticated requests don't have to go to Postgres
+// every time. Entries expire after the TTL and are dropped explicitly when
+// the models change the underlying rows. A TTL of zero disables the cache
+type Cache struct {
+	ttl         time.Duration
+	mu          sync.Mutex
+	users       map[[32]byte]cachedUser
+	permissions map[int64]cachedPermissions
+	touched     map[[32]byte]time.Time
+	lastSweep   time.Time
+	hits        uint64
+	misses      uint64
+}
+
+type cachedUser struct {
+	user    User
+	expires time.Time
+}
+
+type cachedPermissions struct {
+	permissions Permissions
+	expires     time.Time
+}
+
+// CacheStats reports how well the cache is doing
+type CacheStats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Users       int    `json:"users"`
+	Permissions int    `json:"permissions"`
+}
+
+// NewCache() creates a Cache whose entries live for ttl
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:         ttl,
+		users:       make(map[[32]byte]cachedUser),
+		permissions: make(map[int64]cachedPermissions),
+		touched:     make(map[[32]byte]time.Time),
+		lastSweep:   time.Now(),
+	}
+}
+
+func (c *Cache) enabled() bool {
+	return c != nil && c.ttl > 0
+}
+
+// getUser looks up the user behind an authentication token
+func (c *Cache) getUser(tokenPlaintext string) (*User, bool) {
+	if !c.enabled() {
+		return nil, false
+	}
+	key := sha256.Sum256([]byte(tokenPlaintext))
+	c.mu.Lock()
+	entry, ok := c.users[key]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.users, key)
+		ok = false
+	}
+	c.mu.Unlock()
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	// Hand out a copy so that callers can't change the cached entry
+	user := entry.user
+	return &user, true
+}
+
+// setUser remembers the user behind an authentication token. The entry
+// never outlives the token itself
+func (c *Cache) setUser(tokenPlaintext string, user *User, tokenExpiry time.Time) {
+	if !c.enabled() {
+		return
+	}
+	expires := time.Now().Add(c.ttl)
+	if tokenExpiry.Before(expires) {
+		expires = tokenExpiry
+	}
+	key := sha256.Sum256([]byte(tokenPlaintext))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.users[key] = cachedUser{user: *user, expires: expires}
+	c.sweep()
+}
+
+// getPermissions looks up the resolved permission codes of a user
+func (c *Cache) getPermissions(userID int64) (Permissions, bool) {
+	if !c.enabled() {
+		return nil, false
+	}
+	c.mu.Lock()
+	entry, ok := c.permissions[userID]
+	if ok && time.Now().After(entry.expires) {
+		delete(c.permissions, userID)
+		ok = false
+	}
+	c.mu.Unlock()
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return append(Permissions(nil), entry.permissions...), true
+}
+
+// setPermissions remembers the resolved permission codes of a user
+func (c *Cache) setPermissions(userID int64, permissions Permissions) {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.permissions[userID] = cachedPermissions{
+		permissions: append(Permissions(nil), permissions...),
+		expires:     time.Now().Add(c.ttl),
+	}
+	c.sweep()
+}
+
+// touchedRecently reports whether a token's last use was written within
+// the last minute, and records the write if it wasn't
+func (c *Cache) touchedRecently(tokenPlaintext string) bool {
+	if !c.enabled() {
+		return false
+	}
+	key := sha256.Sum256([]byte(tokenPlaintext))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if last, ok := c.touched[key]; ok && time.Since(last) < time.Minute {
+		return true
+	}
+	c.touched[key] = time.Now()
+	return false
+}
+
+// InvalidateUser drops every cached entry that belongs to a user. It is
+// called whenever the user's account, tokens or permissions change
+func (c *Cache) InvalidateUser(userID int64) {
+	if !c.enabled() {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.users {
+		if entry.user.ID == userID {
+			delete(c.users, key)
+			delete(c.touched, key)
+		}
+	}
+	delete(c.permissions, userID)
+}
+
+// Stats returns the hit and miss counters and the number of live entries
+func (c *Cache) Stats() CacheStats {
+	if c == nil {
+		return CacheStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{
+		Hits:        atomic.LoadUint64(&c.hits),
+		Misses:      atomic.LoadUint64(&c.misses),
+		Users:       len(c.users),
+		Permissions: len(c.permissions),
+	}
+}
+
+// sweep removes expired entries once per TTL. The caller must hold the lock
+func (c *Cache) sweep() {
+	now := time.Now()
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for key, entry := range c.users {
+		if now.After(entry.expires) {
+			delete(c.users, key)
+		}
+	}
+	for userID, entry := range c.permissions {
+		if now.After(entry.expires) {
+			delete(c.permissions, userID)
+		}
+	}
+	for key, last := range c.touched {
+		if now.Sub(last) >= time.Minute {
+			delete(c.touched, key)
+		}
+	}
+}
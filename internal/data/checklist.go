@@ -0,0 +1,151 @@
+// Filename: internal/data/checklist.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// A ChecklistItem is a step of a todo that is too small to be a todo itself
+type ChecklistItem struct {
+	ID        int64     `json:"id"`
+	TodoID    int64     `json:"todo_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Text      string    `json:"text"`
+	Done      bool      `json:"done"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateChecklistItem(v *validator.Validator, item *ChecklistItem) {
+	v.Check(item.Text != "", "text", "must be provided")
+	v.Check(len(item.Text) <= 200, "text", "must not be more than 200 bytes long")
+}
+
+type ChecklistModel struct {
+	DB *sql.DB
+}
+
+// Insert() adds an item to the end of a todo's checklist
+func (m ChecklistModel) Insert(item *ChecklistItem) error {
+	query := `
+		INSERT INTO todo_checklist_items (todo_id, text, done)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, item.TodoID, item.Text, item.Done).Scan(&item.ID, &item.CreatedAt, &item.Version)
+}
+
+// Get() returns an item from a todo's checklist
+func (m ChecklistModel) Get(id int64, todoID int64) (*ChecklistItem, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT id, todo_id, created_at, text, done, version
+		FROM todo_checklist_items
+		WHERE id = $1
+		AND todo_id = $2
+	`
+	var item ChecklistItem
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, todoID).Scan(
+		&item.ID, &item.TodoID, &item.CreatedAt, &item.Text, &item.Done, &item.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &item, nil
+}
+
+// GetAllForTodo() returns a todo's checklist in the order it was written
+func (m ChecklistModel) GetAllForTodo(todoID int64) ([]*ChecklistItem, error) {
+	query := `
+		SELECT id, todo_id, created_at, text, done, version
+		FROM todo_checklist_items
+		WHERE todo_id = $1
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, todoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []*ChecklistItem{}
+	for rows.Next() {
+		var item ChecklistItem
+		err := rows.Scan(&item.ID, &item.TodoID, &item.CreatedAt, &item.Text, &item.Done, &item.Version)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Update() saves an item, using its version for optimistic locking
+func (m ChecklistModel) Update(item *ChecklistItem) error {
+	query := `
+		UPDATE todo_checklist_items
+		SET text = $1, done = $2, version = version + 1
+		WHERE id = $3
+		AND todo_id = $4
+		AND version = $5
+		RETURNING version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, item.Text, item.Done, item.ID, item.TodoID, item.Version).Scan(&item.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes an item from a todo's checklist
+func (m ChecklistModel) Delete(id int64, todoID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	query := `
+		DELETE FROM todo_checklist_items
+		WHERE id = $1
+		AND todo_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, todoID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
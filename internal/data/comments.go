@@ -0,0 +1,233 @@
+// Filename: internal/data/comments.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// A Comment is a message in the discussion of a todo. AuthorID is nil
+// once the author's account has been deleted
+type Comment struct {
+	ID         int64      `json:"id"`
+	TodoID     int64      `json:"todo_id"`
+	AuthorID   *int64     `json:"author_id"`
+	AuthorName string     `json:"author_name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	EditedAt   *time.Time `json:"edited_at,omitempty"`
+	Body       string     `json:"body"`
+	Version    int32      `json:"version"`
+}
+
+// A CommentEdit is the body a comment had before it was edited
+type CommentEdit struct {
+	ID        int64     `json:"id"`
+	CommentID int64     `json:"comment_id"`
+	CreatedAt time.Time `json:"replaced_at"`
+	Body      string    `json:"body"`
+}
+
+func ValidateComment(v *validator.Validator, comment *Comment) {
+	v.Check(comment.Body != "", "body", "must be provided")
+	v.Check(len(comment.Body) <= 5000, "body", "must not be more than 5000 bytes long")
+}
+
+type CommentModel struct {
+	DB *sql.DB
+}
+
+// commentColumns lists the columns every comment query selects, in the
+// order that commentDestinations() scans them
+const commentColumns = `todo_comments.id, todo_comments.todo_id, todo_comments.user_id, COALESCE(users.name, ''),
+		todo_comments.created_at, todo_comments.edited_at, todo_comments.body, todo_comments.version`
+
+func commentDestinations(comment *Comment) []interface{} {
+	return []interface{}{
+		&comment.ID,
+		&comment.TodoID,
+		&comment.AuthorID,
+		&comment.AuthorName,
+		&comment.CreatedAt,
+		&comment.EditedAt,
+		&comment.Body,
+		&comment.Version,
+	}
+}
+
+// Insert() adds a comment to a todo
+func (m CommentModel) Insert(comment *Comment) error {
+	query := `
+		INSERT INTO todo_comments (todo_id, user_id, body)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, comment.TodoID, comment.AuthorID, comment.Body).Scan(&comment.ID, &comment.CreatedAt, &comment.Version)
+}
+
+// Get() returns a comment on a todo
+func (m CommentModel) Get(id int64, todoID int64) (*Comment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + commentColumns + `
+		FROM todo_comments
+		LEFT JOIN users ON users.id = todo_comments.user_id
+		WHERE todo_comments.id = $1
+		AND todo_comments.todo_id = $2
+	`
+	var comment Comment
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, todoID).Scan(commentDestinations(&comment)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &comment, nil
+}
+
+// GetAllForTodo() returns a page of the comments on a todo, sorted by id
+func (m CommentModel) GetAllForTodo(todoID int64, filters Filters) ([]*Comment, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), `+commentColumns+`
+		FROM todo_comments
+		LEFT JOIN users ON users.id = todo_comments.user_id
+		WHERE todo_comments.todo_id = $1
+		ORDER BY todo_comments.%s %s
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortOrder())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, todoID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	comments := []*Comment{}
+	for rows.Next() {
+		var comment Comment
+		err := rows.Scan(append([]interface{}{&totalRecords}, commentDestinations(&comment)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		comments = append(comments, &comment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return comments, metadata, nil
+}
+
+// Update() saves an edited comment, using its version for optimistic
+// locking. The body it replaces is kept in the comment's edits
+func (m CommentModel) Update(comment *Comment) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := `
+		INSERT INTO todo_comment_edits (comment_id, body)
+		SELECT id, body FROM todo_comments
+		WHERE id = $1
+		AND todo_id = $2
+		AND version = $3
+	`
+	result, err := tx.ExecContext(ctx, query, comment.ID, comment.TodoID, comment.Version)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrEditConflict
+	}
+	query = `
+		UPDATE todo_comments
+		SET body = $1, edited_at = NOW(), version = version + 1
+		WHERE id = $2
+		AND version = $3
+		RETURNING edited_at, version
+	`
+	err = tx.QueryRowContext(ctx, query, comment.Body, comment.ID, comment.Version).Scan(&comment.EditedAt, &comment.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Delete() removes a comment from a todo, along with its edits
+func (m CommentModel) Delete(id int64, todoID int64) error {
+	query := `
+		DELETE FROM todo_comments
+		WHERE id = $1
+		AND todo_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, id, todoID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetEdits() returns the bodies a comment had before each of its edits,
+// oldest first
+func (m CommentModel) GetEdits(commentID int64) ([]*CommentEdit, error) {
+	query := `
+		SELECT id, comment_id, created_at, body
+		FROM todo_comment_edits
+		WHERE comment_id = $1
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	edits := []*CommentEdit{}
+	for rows.Next() {
+		var edit CommentEdit
+		if err := rows.Scan(&edit.ID, &edit.CommentID, &edit.CreatedAt, &edit.Body); err != nil {
+			return nil, err
+		}
+		edits = append(edits, &edit)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return edits, nil
+}
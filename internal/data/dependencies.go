@@ -0,0 +1,182 @@
+// Filename: internal/data/dependencies.go
+
+package data
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	ErrDependencyCycle     = errors.New("dependency cycle")
+	ErrDuplicateDependency = errors.New("duplicate dependency")
+)
+
+// GetSubtasks() returns the child todos of a todo
+func (m TodoModel) GetSubtasks(parentID int64) ([]*Todo, error) {
+	query := `
+		SELECT ` + todoColumns + `
+		FROM todo
+		WHERE parent_id = $1
+		AND deleted_at IS NULL
+		ORDER BY id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return queryTodos(ctx, m.DB, query, parentID)
+}
+
+// GetBlockers() returns the todos that block a todo
+func (m TodoModel) GetBlockers(todoID int64) ([]*Todo, error) {
+	query := `
+		SELECT ` + todoColumns + `
+		FROM todo
+		INNER JOIN todo_dependencies ON todo_dependencies.blocked_by_id = todo.id
+		WHERE todo_dependencies.todo_id = $1
+		AND todo.deleted_at IS NULL
+		ORDER BY todo.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return queryTodos(ctx, m.DB, query, todoID)
+}
+
+// GetBlocking() returns the todos that a todo blocks
+func (m TodoModel) GetBlocking(todoID int64) ([]*Todo, error) {
+	query := `
+		SELECT ` + todoColumns + `
+		FROM todo
+		INNER JOIN todo_dependencies ON todo_dependencies.todo_id = todo.id
+		WHERE todo_dependencies.blocked_by_id = $1
+		AND todo.deleted_at IS NULL
+		ORDER BY todo.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return queryTodos(ctx, m.DB, query, todoID)
+}
+
+// queryTodos() runs a query that returns todoColumns using q and scans
+// every row
+func queryTodos(ctx context.Context, q dbtx, query string, args ...interface{}) ([]*Todo, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	todos := []*Todo{}
+	for rows.Next() {
+		var todo Todo
+		if err := rows.Scan(todoDestinations(&todo)...); err != nil {
+			return nil, err
+		}
+		todos = append(todos, &todo)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return todos, nil
+}
+
+// OpenBlockers() counts the todos blocking a todo that are not yet
+// finished
+func (m TodoModel) OpenBlockers(todoID int64) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return openBlockers(ctx, m.DB, todoID)
+}
+
+// openBlockers() does the work of OpenBlockers() using q
+func openBlockers(ctx context.Context, q dbtx, todoID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM todo_dependencies
+		INNER JOIN todo ON todo.id = todo_dependencies.blocked_by_id
+		WHERE todo_dependencies.todo_id = $1
+		AND todo.status NOT IN ('done', 'cancelled')
+		AND todo.deleted_at IS NULL
+	`
+	var count int
+	err := q.QueryRowContext(ctx, query, todoID).Scan(&count)
+	return count, err
+}
+
+// AddDependency() records that todoID is blocked by blockedByID. A
+// dependency that would close a loop returns ErrDependencyCycle
+func (m TodoModel) AddDependency(todoID, blockedByID int64) error {
+	if todoID == blockedByID {
+		return ErrDependencyCycle
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Two requests adding the two halves of a loop at once would each pass
+	// the cycle check, so writers take turns
+	_, err = tx.ExecContext(ctx, `LOCK TABLE todo_dependencies IN SHARE ROW EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+	// Walk everything blockedByID waits on; reaching todoID means a loop
+	query := `
+		WITH RECURSIVE chain(id) AS (
+			SELECT blocked_by_id FROM todo_dependencies WHERE todo_id = $2
+			UNION
+			SELECT todo_dependencies.blocked_by_id
+			FROM todo_dependencies
+			INNER JOIN chain ON todo_dependencies.todo_id = chain.id
+		)
+		SELECT EXISTS (SELECT 1 FROM chain WHERE id = $1)
+	`
+	var cycle bool
+	if err = tx.QueryRowContext(ctx, query, todoID, blockedByID).Scan(&cycle); err != nil {
+		return err
+	}
+	if cycle {
+		return ErrDependencyCycle
+	}
+	query = `
+		INSERT INTO todo_dependencies (todo_id, blocked_by_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	result, err := tx.ExecContext(ctx, query, todoID, blockedByID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrDuplicateDependency
+	}
+	return tx.Commit()
+}
+
+// RemoveDependency() removes the dependency of todoID on blockedByID
+func (m TodoModel) RemoveDependency(todoID, blockedByID int64) error {
+	query := `
+		DELETE FROM todo_dependencies
+		WHERE todo_id = $1
+		AND blocked_by_id = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, query, todoID, blockedByID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
@@ -3,6 +3,9 @@
 package data
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"math"
 	"strings"
 
@@ -14,16 +17,24 @@ type Filters struct {
 	PageSize int
 	Sort     string
 	SortList []string
+	// Cursor is an opaque position returned by a previous listing.
+	// When it is set the listing walks from there instead of using Page
+	Cursor string
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
 	//Check page and page_size parameters
 	v.Check(f.Page > 0, "page", "must be greater than zero")
 	v.Check(f.Page <= 1000, "page", "must be maximum of 1000")
-	v.Check(f.Page > 0, "page_size", "must be greater than zero")
-	v.Check(f.Page <= 100, "page_size", "must be maximum of 100")
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "must be maximum of 100")
 	//Check that the sort parameter matches a value in the sort list
 	v.Check(validator.In(f.Sort, f.SortList...), "sort", "invalid sort value")
+	//A cursor only makes sense for the sort order it was created with
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil && c.Sort == f.Sort, "cursor", "invalid cursor for this sort order")
+	}
 }
 
 // The sortColumn() method safely extracts the sort field query parameter
@@ -54,13 +65,16 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
-//the Metadata type contains metadate to help with pagination
+//the Metadata type contains metadate to help with pagination. The page
+//mode keys are spelt the way clients have always received them
 type Metadata struct {
-	CurrentPage  int `json: "current_page,omitempty"`
-	PageSize     int `json: "page_size,omitempty"`
-	FirstPage    int `json: "first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json: "last_records,omitempty"`
+	CurrentPage  int    `json:"CurrentPage"`
+	PageSize     int    `json:"PageSize"`
+	FirstPage    int    `json:"FirstPage"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"TotalRecords"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 //The calculateMetadata() function computes the values for the Metadata fields
@@ -76,3 +90,135 @@ func calculateMetadata(totalRecords int, page int, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// A Cursor marks the row a keyset listing continues from. It holds the
+// value of the sort column and the id of that row, which together give a
+// stable position however deep the listing goes
+type Cursor struct {
+	Sort     string `json:"s"`
+	Key      string `json:"k"`
+	ID       int64  `json:"id"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// encode() turns the cursor into the opaque string handed to clients
+func (c Cursor) encode() string {
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// decodeCursor() reverses encode()
+func decodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(js, &c)
+	return c, err
+}
+
+// The usesCursor() method reports whether the listing is in keyset mode
+func (f Filters) usesCursor() bool {
+	return f.Cursor != ""
+}
+
+// The cursor() method returns the decoded cursor. ValidateFilters()
+// has already rejected cursors that can't be decoded
+func (f Filters) cursor() Cursor {
+	c, _ := decodeCursor(f.Cursor)
+	return c
+}
+
+// The queryOrder() method is the direction rows are fetched in. Walking
+// backwards from a cursor fetches in the opposite direction
+func (f Filters) queryOrder() string {
+	if f.usesCursor() && f.cursor().Backward {
+		if f.sortOrder() == "ASC" {
+			return "DESC"
+		}
+		return "ASC"
+	}
+	return f.sortOrder()
+}
+
+// The idOrder() method is the direction ties are broken by id in. Ties
+// always come in ascending id order, as they did before cursors, so rows
+// are fetched by descending id when walking backwards
+func (f Filters) idOrder() string {
+	if f.usesCursor() && f.cursor().Backward {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// The keysetCondition() method returns the WHERE clause fragment that
+// skips to the cursor. orderBy is the expression the listing is sorted by
+// and the cursor's key and id are bound to $n and $n+1
+func (f Filters) keysetCondition(orderBy string, n int) string {
+	if !f.usesCursor() {
+		return ""
+	}
+	op := ">"
+	if f.queryOrder() == "DESC" {
+		op = "<"
+	}
+	idOp := ">"
+	if f.idOrder() == "DESC" {
+		idOp = "<"
+	}
+	return fmt.Sprintf("AND (%[1]s %[2]s $%[3]d OR (%[1]s = $%[3]d AND id %[4]s $%[5]d))", orderBy, op, n, idOp, n+1)
+}
+
+// The keysetArgs() method returns the values for keysetCondition()
+func (f Filters) keysetArgs() []interface{} {
+	if !f.usesCursor() {
+		return nil
+	}
+	c := f.cursor()
+	return []interface{}{c.Key, c.ID}
+}
+
+// The queryLimit() method fetches one extra row in keyset mode so that
+// we can tell whether there is anything beyond this page
+func (f Filters) queryLimit() int {
+	if f.usesCursor() {
+		return f.limit() + 1
+	}
+	return f.limit()
+}
+
+// The queryOffset() method is only used in page mode
+func (f Filters) queryOffset() int {
+	if f.usesCursor() {
+		return 0
+	}
+	return f.offset()
+}
+
+// The calculateCursors() method fills in the cursors that lead away from
+// a page. first and last are the keys of the first and last rows shown
+func (f Filters) calculateCursors(metadata Metadata, hasMore bool, first, last Cursor) Metadata {
+	first.Sort, last.Sort = f.Sort, f.Sort
+	first.Backward = true
+	if f.usesCursor() {
+		// We arrived from a neighbouring page, so there is always
+		// something in the direction we came from
+		backward := f.cursor().Backward
+		metadata.PageSize = f.PageSize
+		if hasMore || backward {
+			metadata.NextCursor = last.encode()
+		}
+		if hasMore || !backward {
+			metadata.PrevCursor = first.encode()
+		}
+		return metadata
+	}
+	if metadata.CurrentPage < metadata.LastPage {
+		metadata.NextCursor = last.encode()
+	}
+	if metadata.CurrentPage > 1 {
+		metadata.PrevCursor = first.encode()
+	}
+	return metadata
+}
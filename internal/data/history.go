@@ -0,0 +1,188 @@
+// Filename: internal/data/history.go
+
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// The changes recorded in a todo's history
+const (
+	HistoryCreate  = "create"
+	HistoryUpdate  = "update"
+	HistoryDelete  = "delete"
+	HistoryRestore = "restore"
+)
+
+// A FieldChange holds the JSON values of a field before and after a change
+type FieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// A TodoHistory row records one change to a todo. UserID is nil for
+// changes made by the server itself or by users who have since left
+type TodoHistory struct {
+	ID        int64                  `json:"id"`
+	TodoID    int64                  `json:"todo_id"`
+	Version   int32                  `json:"version"`
+	Action    string                 `json:"action"`
+	UserID    *int64                 `json:"user_id"`
+	CreatedAt time.Time              `json:"created_at"`
+	Changes   map[string]FieldChange `json:"changes"`
+}
+
+// untrackedFields change with every write, so they are left out of diffs
+var untrackedFields = map[string]bool{
+	"version":    true,
+	"updated_at": true,
+}
+
+// diffTodos() compares two todos field by field as they appear in JSON. A
+// nil old todo diffs against an empty one
+func diffTodos(old, new *Todo) (map[string]FieldChange, error) {
+	before, err := todoFields(old)
+	if err != nil {
+		return nil, err
+	}
+	after, err := todoFields(new)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]bool{}
+	for field := range before {
+		fields[field] = true
+	}
+	for field := range after {
+		fields[field] = true
+	}
+	null := json.RawMessage("null")
+	changes := map[string]FieldChange{}
+	for field := range fields {
+		if untrackedFields[field] {
+			continue
+		}
+		from, to := before[field], after[field]
+		if from == nil {
+			from = null
+		}
+		if to == nil {
+			to = null
+		}
+		if !bytes.Equal(from, to) {
+			changes[field] = FieldChange{From: from, To: to}
+		}
+	}
+	return changes, nil
+}
+
+// todoFields() splits the JSON form of a todo into its fields
+func todoFields(todo *Todo) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if todo == nil {
+		return fields, nil
+	}
+	js, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(js, &fields)
+	return fields, err
+}
+
+// recordHistory() stores the change from old to new, along with a snapshot
+// of new so that the todo can later be reverted to it
+func recordHistory(ctx context.Context, q dbtx, actorID int64, action string, old, new *Todo) error {
+	changes, err := diffTodos(old, new)
+	if err != nil {
+		return err
+	}
+	changesJSON, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	snapshot, err := json.Marshal(new)
+	if err != nil {
+		return err
+	}
+	var userID *int64
+	if actorID > 0 {
+		userID = &actorID
+	}
+	query := `
+		INSERT INTO todo_history (todo_id, version, action, user_id, changes, snapshot)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	// jsonb parameters are sent as text; lib/pq would send []byte as bytea
+	_, err = q.ExecContext(ctx, query, new.ID, new.Version, action, userID, string(changesJSON), string(snapshot))
+	return err
+}
+
+// GetHistory() returns a page of a todo's history, newest first
+func (m TodoModel) GetHistory(todoID int64, filters Filters) ([]*TodoHistory, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), id, todo_id, version, action, user_id, created_at, changes
+		FROM todo_history
+		WHERE todo_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, todoID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	history := []*TodoHistory{}
+	for rows.Next() {
+		var entry TodoHistory
+		var changes []byte
+		err := rows.Scan(&totalRecords, &entry.ID, &entry.TodoID, &entry.Version, &entry.Action, &entry.UserID, &entry.CreatedAt, &changes)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		if err = json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, Metadata{}, err
+		}
+		history = append(history, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return history, metadata, nil
+}
+
+// GetVersion() returns a todo as it was saved at the given version
+func (m TodoModel) GetVersion(todoID int64, version int32) (*Todo, error) {
+	query := `
+		SELECT snapshot
+		FROM todo_history
+		WHERE todo_id = $1
+		AND version = $2
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var snapshot []byte
+	err := m.DB.QueryRowContext(ctx, query, todoID, version).Scan(&snapshot)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	var todo Todo
+	if err = json.Unmarshal(snapshot, &todo); err != nil {
+		return nil, err
+	}
+	return &todo, nil
+}
@@ -0,0 +1,415 @@
+// Filename: internal/data/lists.go
+
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"alysianorales.net/TODO/internal/validator"
+)
+
+// The roles a member can have on a list, from least to most trusted.
+// Viewers can read the list's todos, editors can also change them and
+// owners can also manage the list and its members
+const (
+	ListRoleViewer = "viewer"
+	ListRoleEditor = "editor"
+	ListRoleOwner  = "owner"
+)
+
+var ListRoles = []string{ListRoleViewer, ListRoleEditor, ListRoleOwner}
+
+var (
+	// ErrLastOwner is returned when a change would leave a list without an owner
+	ErrLastOwner = errors.New("last owner")
+)
+
+// ListRoleAtLeast() reports whether role grants everything that min does
+func ListRoleAtLeast(role, min string) bool {
+	rank := func(role string) int {
+		for i, r := range ListRoles {
+			if r == role {
+				return i
+			}
+		}
+		return -1
+	}
+	return rank(role) >= rank(min) && rank(role) >= 0
+}
+
+// A List groups todos so that they can be shared. Role is the role of the
+// user the list was read for
+type List struct {
+	ID          int64     `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Role        string    `json:"role"`
+	Version     int32     `json:"version"`
+}
+
+func ValidateListDetails(v *validator.Validator, list *List) {
+	v.Check(list.Name != "", "name", "must be provided")
+	v.Check(len(list.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(list.Description) <= 1000, "description", "must not be more than 1000 bytes long")
+}
+
+func ValidateListRole(v *validator.Validator, role string) {
+	v.Check(validator.In(role, ListRoles...), "role", "must be one of viewer, editor, owner")
+}
+
+// A ListMember is a user who has a role on a list
+type ListMember struct {
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"joined_at"`
+}
+
+// A ListInvitation offers a role on a list to whoever holds the email it
+// was sent to
+type ListInvitation struct {
+	Plaintext string    `json:"-"`
+	Hash      []byte    `json:"-"`
+	ListID    int64     `json:"list_id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy int64     `json:"invited_by"`
+	CreatedAt time.Time `json:"created_at"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+// Insert() adds a list with ownerID as its first owner
+func (m ListModel) Insert(list *List, ownerID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	query := `
+		INSERT INTO lists (name, description)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version
+	`
+	err = tx.QueryRowContext(ctx, query, list.Name, list.Description).Scan(&list.ID, &list.CreatedAt, &list.Version)
+	if err != nil {
+		return err
+	}
+	query = `
+		INSERT INTO list_members (list_id, user_id, role)
+		VALUES ($1, $2, $3)
+	`
+	if _, err = tx.ExecContext(ctx, query, list.ID, ownerID, ListRoleOwner); err != nil {
+		return err
+	}
+	list.Role = ListRoleOwner
+	return tx.Commit()
+}
+
+// Get() returns a list that userID is a member of, along with their role
+func (m ListModel) Get(id int64, userID int64) (*List, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT lists.id, lists.created_at, lists.name, lists.description, list_members.role, lists.version
+		FROM lists
+		INNER JOIN list_members ON list_members.list_id = lists.id
+		WHERE lists.id = $1
+		AND list_members.user_id = $2
+	`
+	var list List
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&list.ID, &list.CreatedAt, &list.Name, &list.Description, &list.Role, &list.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &list, nil
+}
+
+// GetRole() returns the role userID has on a list
+func (m ListModel) GetRole(listID int64, userID int64) (string, error) {
+	query := `
+		SELECT role FROM list_members
+		WHERE list_id = $1
+		AND user_id = $2
+	`
+	var role string
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, listID, userID).Scan(&role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrRecordNotFound
+		default:
+			return "", err
+		}
+	}
+	return role, nil
+}
+
+// GetAllForUser() returns a page of the lists userID is a member of
+func (m ListModel) GetAllForUser(userID int64, filters Filters) ([]*List, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), lists.id, lists.created_at, lists.name, lists.description, list_members.role, lists.version
+		FROM lists
+		INNER JOIN list_members ON list_members.list_id = lists.id
+		WHERE list_members.user_id = $1
+		ORDER BY lists.name, lists.id
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	lists := []*List{}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(&totalRecords, &list.ID, &list.CreatedAt, &list.Name, &list.Description, &list.Role, &list.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		lists = append(lists, &list)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return lists, metadata, nil
+}
+
+// Update() saves a list's details, using its version for optimistic locking
+func (m ListModel) Update(list *List) error {
+	query := `
+		UPDATE lists
+		SET name = $1, description = $2, version = version + 1
+		WHERE id = $3
+		AND version = $4
+		RETURNING version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, list.Name, list.Description, list.ID, list.Version).Scan(&list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete() removes a list. Its todos are kept and go back to the people
+// who created them
+func (m ListModel) Delete(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	result, err := m.DB.ExecContext(ctx, `DELETE FROM lists WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetMembers() returns the members of a list, owners first
+func (m ListModel) GetMembers(listID int64) ([]*ListMember, error) {
+	query := `
+		SELECT users.id, users.name, users.email, list_members.role, list_members.created_at
+		FROM list_members
+		INNER JOIN users ON users.id = list_members.user_id
+		WHERE list_members.list_id = $1
+		ORDER BY array_position(ARRAY['owner', 'editor', 'viewer'], list_members.role), users.name, users.id
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	members := []*ListMember{}
+	for rows.Next() {
+		var member ListMember
+		err := rows.Scan(&member.UserID, &member.Name, &member.Email, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SetRole() changes the role of a member. The last owner of a list can't
+// give up their role
+func (m ListModel) SetRole(listID int64, userID int64, role string) error {
+	return m.changeMember(listID, `
+		UPDATE list_members SET role = $3
+		WHERE list_id = $1
+		AND user_id = $2
+	`, userID, role)
+}
+
+// RemoveMember() takes a user off a list. The last owner of a list can't
+// be removed
+func (m ListModel) RemoveMember(listID int64, userID int64) error {
+	return m.changeMember(listID, `
+		DELETE FROM list_members
+		WHERE list_id = $1
+		AND user_id = $2
+	`, userID)
+}
+
+// changeMember() runs a query that changes a member of a list, then checks
+// that the list still has an owner. The list row is locked so that two
+// owners can't step down at the same time
+func (m ListModel) changeMember(listID int64, query string, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `SELECT id FROM lists WHERE id = $1 FOR UPDATE`, listID)
+	if err != nil {
+		return err
+	}
+	result, err := tx.ExecContext(ctx, query, append([]interface{}{listID}, args...)...)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+	var owners int
+	query = `SELECT COUNT(*) FROM list_members WHERE list_id = $1 AND role = 'owner'`
+	if err = tx.QueryRowContext(ctx, query, listID).Scan(&owners); err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return tx.Commit()
+}
+
+// NewInvitation() creates an invitation to a list for email. It replaces
+// any invitation the address already has to the list
+func (m ListModel) NewInvitation(listID int64, email, role string, invitedBy int64, ttl time.Duration) (*ListInvitation, error) {
+	token, err := generateToken(invitedBy, ttl, "")
+	if err != nil {
+		return nil, err
+	}
+	invitation := &ListInvitation{
+		Plaintext: token.Plaintext,
+		Hash:      token.Hash,
+		ListID:    listID,
+		Email:     email,
+		Role:      role,
+		InvitedBy: invitedBy,
+		Expiry:    token.Expiry,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `DELETE FROM list_invitations WHERE list_id = $1 AND email = $2::citext`, listID, email)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		INSERT INTO list_invitations (hash, list_id, email, role, invited_by, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`
+	args := []interface{}{invitation.Hash, listID, email, role, invitedBy, invitation.Expiry}
+	if err = tx.QueryRowContext(ctx, query, args...).Scan(&invitation.CreatedAt); err != nil {
+		return nil, err
+	}
+	return invitation, tx.Commit()
+}
+
+// AcceptInvitation() makes user a member of the list an invitation is for.
+// The invitation must not have expired and must have been sent to the
+// user's email. A member keeps being an owner when invited with a lesser role
+func (m ListModel) AcceptInvitation(tokenPlaintext string, user *User) (int64, error) {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	query := `
+		DELETE FROM list_invitations
+		WHERE hash = $1
+		AND email = $2::citext
+		AND expiry > NOW()
+		RETURNING list_id, role
+	`
+	var listID int64
+	var role string
+	err = tx.QueryRowContext(ctx, query, hash[:], user.Email).Scan(&listID, &role)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+	query = `
+		INSERT INTO list_members (list_id, user_id, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (list_id, user_id) DO UPDATE
+		SET role = EXCLUDED.role
+		WHERE list_members.role <> 'owner'
+	`
+	if _, err = tx.ExecContext(ctx, query, listID, user.ID, role); err != nil {
+		return 0, err
+	}
+	return listID, tx.Commit()
+}
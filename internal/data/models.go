@@ -3,8 +3,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -12,20 +14,44 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// dbtx is satisfied by both *sql.DB and *sql.Tx so that a query can
+// run inside or outside of a transaction
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
 //A wrapper for our data models
 type Models struct {
+	Attachments AttachmentModel
+	Cache       *Cache
+	Checklist   ChecklistModel
+	Comments    CommentModel
+	Lists       ListModel
 	Permissions PermissionModel
+	Roles       RoleModel
+	Tags        TagModel
 	Todo        TodoModel
 	Tokens      TokenModel
 	Users       UserModel
 }
 
-//New Models() allows us to create a new Model
-func NewModels(db *sql.DB) Models {
+//New Models() allows us to create a new Model. Token and permission
+//lookups are cached for cacheTTL; a cacheTTL of zero disables the cache
+func NewModels(db *sql.DB, cacheTTL time.Duration) Models {
+	cache := NewCache(cacheTTL)
 	return Models{
-		Permissions: PermissionModel{DB: db},
+		Attachments: AttachmentModel{DB: db},
+		Cache:       cache,
+		Checklist:   ChecklistModel{DB: db},
+		Comments:    CommentModel{DB: db},
+		Lists:       ListModel{DB: db},
+		Permissions: PermissionModel{DB: db, Cache: cache},
+		Roles:       RoleModel{DB: db, Cache: cache},
+		Tags:        TagModel{DB: db},
 		Todo:        TodoModel{DB: db},
-		Tokens:      TokenModel{DB: db},
-		Users:       UserModel{DB: db},
+		Tokens:      TokenModel{DB: db, Cache: cache},
+		Users:       UserModel{DB: db, Cache: cache},
 	}
 }
@@ -23,19 +23,31 @@ func (p Permissions) Include(code string) bool {
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *Cache
 }
 
+// GetAllForUser resolves the codes granted to the user directly
+// together with the codes granted through their roles
 func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	query := `
 	     SELECT permissions.code
 		 FROM permissions
 		 INNER JOIN users_permissions
 		 ON users_permissions.permission_id = permissions.id
-		 INNER JOIN users
-		 ON users_permissions.user_id = users.id
-		 WHERE users.id = $1
+		 WHERE users_permissions.user_id = $1
+		 UNION
+		 SELECT permissions.code
+		 FROM permissions
+		 INNER JOIN roles_permissions
+		 ON roles_permissions.permission_id = permissions.id
+		 INNER JOIN users_roles
+		 ON users_roles.role_id = roles_permissions.role_id
+		 WHERE users_roles.user_id = $1
 	`
+	if permissions, ok := m.Cache.getPermissions(userID); ok {
+		return permissions, nil
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	rows, err := m.DB.QueryContext(ctx, query, userID)
@@ -56,17 +68,109 @@ func (m PermissionModel) GetAllForUser(userID int64) (Permissions, error) {
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
+	m.Cache.setPermissions(userID, permisisons)
 	return permisisons, nil
 }
 
 func (m PermissionModel) AddForUser(userID int64, codes ...string) error {
 	query := `
 	      INSERT INTO users_permissions
-		  SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)	 
+		  SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+		  ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	m.Cache.InvalidateUser(userID)
+	return err
+}
+
+// RemoveForUser takes permission codes away from a user
+func (m PermissionModel) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+	      DELETE FROM users_permissions
+		  USING permissions
+		  WHERE users_permissions.permission_id = permissions.id
+		  AND users_permissions.user_id = $1
+		  AND permissions.code = ANY($2)
 	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	m.Cache.InvalidateUser(userID)
 	return err
 }
+
+// HeldAfterRevoking reports whether the user would still hold a permission
+// code, directly or through a role, once the given permission codes and
+// role codes had been taken away from them
+func (m PermissionModel) HeldAfterRevoking(userID int64, code string, permissionCodes, roleCodes []string) (bool, error) {
+	query := `
+	     SELECT EXISTS (
+		     SELECT 1
+			 FROM permissions
+			 INNER JOIN users_permissions
+			 ON users_permissions.permission_id = permissions.id
+			 WHERE users_permissions.user_id = $1
+			 AND permissions.code = $2
+			 AND permissions.code <> ALL($3)
+			 UNION ALL
+			 SELECT 1
+			 FROM permissions
+			 INNER JOIN roles_permissions
+			 ON roles_permissions.permission_id = permissions.id
+			 INNER JOIN users_roles
+			 ON users_roles.role_id = roles_permissions.role_id
+			 INNER JOIN roles
+			 ON roles.id = users_roles.role_id
+			 WHERE users_roles.user_id = $1
+			 AND permissions.code = $2
+			 AND roles.code <> ALL($4)
+		 )
+	`
+	// A nil slice would be sent as NULL, which matches nothing
+	if permissionCodes == nil {
+		permissionCodes = []string{}
+	}
+	if roleCodes == nil {
+		roleCodes = []string{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var held bool
+	err := m.DB.QueryRowContext(ctx, query, userID, code, pq.Array(permissionCodes), pq.Array(roleCodes)).Scan(&held)
+	return held, err
+}
+
+// GetAll returns every permission code that can be granted
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+	     SELECT code
+		 FROM permissions
+		 ORDER BY code
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+	for rows.Next() {
+		var permission string
+		err := rows.Scan(&permission)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
@@ -0,0 +1,218 @@
+// Filename: internal/data/recurrence.go
+
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"alysianorales.net/TODO/internal/validator"
+	"github.com/lib/pq"
+)
+
+// The frequencies a recurring todo can repeat at
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+var Frequencies = []string{FrequencyDaily, FrequencyWeekly, FrequencyMonthly}
+
+// weekdays maps the by_weekday values to their time.Weekday
+var weekdays = map[string]time.Weekday{
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+	"sun": time.Sunday,
+}
+
+var Weekdays = []string{"mon", "tue", "wed", "thu", "fri", "sat", "sun"}
+
+// Recurrence is the schedule a recurring todo repeats on. The series ends
+// after Until or after Count occurrences, whichever is set
+type Recurrence struct {
+	Frequency string     `json:"frequency"`
+	Interval  int        `json:"interval"`
+	ByWeekday []string   `json:"by_weekday,omitempty"`
+	Until     *time.Time `json:"until,omitempty"`
+	Count     int        `json:"count,omitempty"`
+	// Occurrence is the position of this todo in the series, starting at 1
+	Occurrence int `json:"occurrence"`
+}
+
+func ValidateRecurrence(v *validator.Validator, r *Recurrence, dueAt *time.Time) {
+	v.Check(dueAt != nil, "due_at", "must be provided for a recurring todo")
+	v.Check(validator.In(r.Frequency, Frequencies...), "recurrence.frequency", "must be one of "+strings.Join(Frequencies, ", "))
+	v.Check(r.Interval >= 1, "recurrence.interval", "must be greater than zero")
+	v.Check(r.Interval <= 365, "recurrence.interval", "must be a maximum of 365")
+	if len(r.ByWeekday) > 0 {
+		v.Check(r.Frequency == FrequencyWeekly, "recurrence.by_weekday", "can only be used with a weekly frequency")
+		v.Check(validator.Unique(r.ByWeekday), "recurrence.by_weekday", "must not contain duplicate days")
+		for _, day := range r.ByWeekday {
+			v.Check(validator.In(day, Weekdays...), "recurrence.by_weekday", "must only contain "+strings.Join(Weekdays, ", "))
+		}
+	}
+	v.Check(r.Until == nil || r.Count == 0, "recurrence", "must not set both until and count")
+	v.Check(r.Count >= 0, "recurrence.count", "must not be negative")
+	if r.Until != nil && dueAt != nil {
+		v.Check(r.Until.After(*dueAt), "recurrence.until", "must be later than due_at")
+	}
+}
+
+// Next() returns the occurrence that follows the one due at t. The second
+// result is false once the series has ended
+func (r Recurrence) Next(t time.Time) (time.Time, bool) {
+	if r.Count > 0 && r.Occurrence >= r.Count {
+		return time.Time{}, false
+	}
+	var next time.Time
+	switch r.Frequency {
+	case FrequencyDaily:
+		next = t.AddDate(0, 0, r.Interval)
+	case FrequencyWeekly:
+		next = r.nextWeekly(t)
+	case FrequencyMonthly:
+		next = addMonths(t, r.Interval)
+	default:
+		return time.Time{}, false
+	}
+	if r.Until != nil && next.After(*r.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// nextWeekly() finds the next listed weekday, skipping the weeks that the
+// interval steps over. Weeks start on a Monday
+func (r Recurrence) nextWeekly(t time.Time) time.Time {
+	if len(r.ByWeekday) == 0 {
+		return t.AddDate(0, 0, 7*r.Interval)
+	}
+	start := weekStart(t)
+	for d := 1; d <= 7*(r.Interval+1); d++ {
+		next := t.AddDate(0, 0, d)
+		weeks := int(weekStart(next).Sub(start).Hours()/24+0.5) / 7
+		if weeks%r.Interval != 0 {
+			continue
+		}
+		for _, day := range r.ByWeekday {
+			if weekdays[day] == next.Weekday() {
+				return next
+			}
+		}
+	}
+	return t.AddDate(0, 0, 7*r.Interval)
+}
+
+// weekStart() returns midnight on the Monday of t's week
+func weekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	y, m, d := t.AddDate(0, 0, -offset).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// addMonths() moves t on by months, keeping to the last day of a shorter
+// month rather than spilling into the next one
+func addMonths(t time.Time, months int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); d > last {
+		d = last
+	}
+	return first.AddDate(0, 0, d-1)
+}
+
+// NextOccurrence() returns the todo that follows a recurring todo in its
+// series, or nil once the series has ended. Occurrences that would already
+// be overdue are skipped
+func NextOccurrence(todo *Todo, now time.Time) *Todo {
+	if todo.Recurrence == nil || todo.DueAt == nil {
+		return nil
+	}
+	rule := *todo.Recurrence
+	dueAt := *todo.DueAt
+	for {
+		next, ok := rule.Next(dueAt)
+		if !ok {
+			return nil
+		}
+		rule.Occurrence++
+		dueAt = next
+		if dueAt.After(now) {
+			break
+		}
+	}
+	return &Todo{
+		UserID:     todo.UserID,
+		ListID:     todo.ListID,
+		AssigneeID: todo.AssigneeID,
+		Title:      todo.Title,
+		Label:      todo.Label,
+		Task:       todo.Task,
+		Priority:   todo.Priority,
+		Status:     StatusTodo,
+		Website:    todo.Website,
+		Address:    todo.Address,
+		Tags:       todo.Tags,
+		DueAt:      &dueAt,
+		Recurrence: &rule,
+	}
+}
+
+// recurrenceColumn selects a todo's rule as JSON so that it can be read
+// along with the todo columns
+const recurrenceColumn = `(SELECT row_to_json(r) FROM todo_recurrence r WHERE r.todo_id = todo.id)`
+
+// recurrenceScanner reads recurrenceColumn into a *Recurrence, leaving it
+// nil for todos that do not repeat
+type recurrenceScanner struct {
+	dst **Recurrence
+}
+
+func (s recurrenceScanner) Scan(src interface{}) error {
+	*s.dst = nil
+	var b []byte
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		b = src
+	case string:
+		b = []byte(src)
+	default:
+		return fmt.Errorf("cannot scan %T into a recurrence", src)
+	}
+	var r Recurrence
+	if err := json.Unmarshal(b, &r); err != nil {
+		return err
+	}
+	*s.dst = &r
+	return nil
+}
+
+// setRecurrence() stores the rule for a todo, or removes it when r is nil
+func setRecurrence(ctx context.Context, q dbtx, todoID int64, r *Recurrence) error {
+	if r == nil {
+		_, err := q.ExecContext(ctx, `DELETE FROM todo_recurrence WHERE todo_id = $1`, todoID)
+		return err
+	}
+	query := `
+		INSERT INTO todo_recurrence (todo_id, frequency, interval, by_weekday, until, count, occurrence)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (todo_id) DO UPDATE
+		SET frequency = $2, interval = $3, by_weekday = $4, until = $5, count = $6, occurrence = $7
+	`
+	byWeekday := r.ByWeekday
+	if byWeekday == nil {
+		byWeekday = []string{}
+	}
+	_, err := q.ExecContext(ctx, query, todoID, r.Frequency, r.Interval, pq.Array(byWeekday), r.Until, r.Count, r.Occurrence)
+	return err
+}
@@ -0,0 +1,248 @@
+// Filename: internal/data/recurrence_test.go
+
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+// day returns 09:00 UTC on the given date
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 9, 0, 0, 0, time.UTC)
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+// The occurrence that follows from under rule. A zero want means the
+// series must have ended
+var nextTests = []struct {
+	name string
+	rule Recurrence
+	from time.Time
+	want time.Time
+}{
+	{
+		name: "daily",
+		rule: Recurrence{Frequency: FrequencyDaily, Interval: 1, Occurrence: 1},
+		from: day(2023, time.January, 31),
+		want: day(2023, time.February, 1),
+	},
+	{
+		name: "every third day",
+		rule: Recurrence{Frequency: FrequencyDaily, Interval: 3, Occurrence: 1},
+		from: day(2023, time.January, 1),
+		want: day(2023, time.January, 4),
+	},
+	{
+		name: "every second week",
+		rule: Recurrence{Frequency: FrequencyWeekly, Interval: 2, Occurrence: 1},
+		from: day(2023, time.January, 2),
+		want: day(2023, time.January, 16),
+	},
+	{
+		name: "Jan 31 + 1 month",
+		rule: Recurrence{Frequency: FrequencyMonthly, Interval: 1, Occurrence: 1},
+		from: day(2023, time.January, 31),
+		want: day(2023, time.February, 28),
+	},
+	{
+		name: "Jan 31 + 1 month in a leap year",
+		rule: Recurrence{Frequency: FrequencyMonthly, Interval: 1, Occurrence: 1},
+		from: day(2024, time.January, 31),
+		want: day(2024, time.February, 29),
+	},
+	{
+		name: "Mar 31 + 1 month",
+		rule: Recurrence{Frequency: FrequencyMonthly, Interval: 1, Occurrence: 1},
+		from: day(2023, time.March, 31),
+		want: day(2023, time.April, 30),
+	},
+	{
+		name: "Dec 31 + 2 months",
+		rule: Recurrence{Frequency: FrequencyMonthly, Interval: 2, Occurrence: 1},
+		from: day(2022, time.December, 31),
+		want: day(2023, time.February, 28),
+	},
+	{
+		name: "Oct 31 + 3 months",
+		rule: Recurrence{Frequency: FrequencyMonthly, Interval: 3, Occurrence: 1},
+		from: day(2023, time.October, 31),
+		want: day(2024, time.January, 31),
+	},
+	{
+		name: "weekdays within a week",
+		rule: Recurrence{Frequency: FrequencyWeekly, Interval: 1, ByWeekday: []string{"mon", "wed", "fri"}, Occurrence: 1},
+		from: day(2023, time.January, 2),
+		want: day(2023, time.January, 4),
+	},
+	{
+		name: "weekdays across a week boundary",
+		rule: Recurrence{Frequency: FrequencyWeekly, Interval: 1, ByWeekday: []string{"mon", "wed", "fri"}, Occurrence: 1},
+		from: day(2023, time.January, 6),
+		want: day(2023, time.January, 9),
+	},
+	{
+		name: "weekdays out of order",
+		rule: Recurrence{Frequency: FrequencyWeekly, Interval: 1, ByWeekday: []string{"fri", "tue"}, Occurrence: 1},
+		from: day(2023, time.January, 2),
+		want: day(2023, time.January, 3),
+	},
+	{
+		name: "Sunday ends the week",
+		rule: Recurrence{Frequency: FrequencyWeekly, Interval: 1, ByWeekday: []string{"sun"}, Occurrence: 1},
+		from: day(2023, time.January, 8),
+		want: day(2023, time.January, 15),
+	},
+	{
+		name: "weekdays every second week, same week",
+		rule: Recurrence{Frequency: FrequencyWeekly, Interval: 2, ByWeekday: []string{"mon", "fri"}, Occurrence: 1},
+		from: day(2023, time.January, 2),
+		want: day(2023, time.January, 6),
+	},
+	{
+		name: "weekdays every second week, skipping a week",
+		rule: Recurrence{Frequency: FrequencyWeekly, Interval: 2, ByWeekday: []string{"mon", "fri"}, Occurrence: 1},
+		from: day(2023, time.January, 6),
+		want: day(2023, time.January, 16),
+	},
+	{
+		name: "count not yet reached",
+		rule: Recurrence{Frequency: FrequencyDaily, Interval: 1, Count: 3, Occurrence: 2},
+		from: day(2023, time.January, 2),
+		want: day(2023, time.January, 3),
+	},
+	{
+		name: "count exhausted",
+		rule: Recurrence{Frequency: FrequencyDaily, Interval: 1, Count: 3, Occurrence: 3},
+		from: day(2023, time.January, 3),
+	},
+	{
+		name: "until on the next occurrence",
+		rule: Recurrence{Frequency: FrequencyDaily, Interval: 1, Until: timePtr(day(2023, time.January, 5)), Occurrence: 1},
+		from: day(2023, time.January, 4),
+		want: day(2023, time.January, 5),
+	},
+	{
+		name: "until passed",
+		rule: Recurrence{Frequency: FrequencyDaily, Interval: 1, Until: timePtr(day(2023, time.January, 5)), Occurrence: 1},
+		from: day(2023, time.January, 5),
+	},
+	{
+		name: "an unknown frequency",
+		rule: Recurrence{Frequency: "yearly", Interval: 1, Occurrence: 1},
+		from: day(2023, time.January, 1),
+	},
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	for _, tt := range nextTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.rule.Next(tt.from)
+			switch {
+			case tt.want.IsZero():
+				if ok {
+					t.Fatalf("got %s; want the series to have ended", got)
+				}
+			case !ok:
+				t.Fatalf("the series ended; want %s", tt.want)
+			case !got.Equal(tt.want):
+				t.Errorf("got %s; want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// The todo that follows a todo due at dueAt, as seen at now. A zero want
+// means there is none
+var nextOccurrenceTests = []struct {
+	name           string
+	rule           Recurrence
+	dueAt          time.Time
+	now            time.Time
+	want           time.Time
+	wantOccurrence int
+}{
+	{
+		name:           "the next occurrence",
+		rule:           Recurrence{Frequency: FrequencyDaily, Interval: 1, Occurrence: 1},
+		dueAt:          day(2023, time.January, 1),
+		now:            day(2022, time.December, 31),
+		want:           day(2023, time.January, 2),
+		wantOccurrence: 2,
+	},
+	{
+		name:           "overdue occurrences are skipped",
+		rule:           Recurrence{Frequency: FrequencyDaily, Interval: 1, Occurrence: 1},
+		dueAt:          day(2023, time.January, 1),
+		now:            day(2023, time.January, 5).Add(3 * time.Hour),
+		want:           day(2023, time.January, 6),
+		wantOccurrence: 6,
+	},
+	{
+		name:           "an occurrence due now is overdue",
+		rule:           Recurrence{Frequency: FrequencyWeekly, Interval: 1, Occurrence: 4},
+		dueAt:          day(2023, time.January, 2),
+		now:            day(2023, time.January, 9),
+		want:           day(2023, time.January, 16),
+		wantOccurrence: 6,
+	},
+	{
+		name:  "count runs out while skipping",
+		rule:  Recurrence{Frequency: FrequencyDaily, Interval: 1, Count: 3, Occurrence: 1},
+		dueAt: day(2023, time.January, 1),
+		now:   day(2023, time.January, 10),
+	},
+	{
+		name:  "until passes while skipping",
+		rule:  Recurrence{Frequency: FrequencyMonthly, Interval: 1, Until: timePtr(day(2023, time.March, 1)), Occurrence: 1},
+		dueAt: day(2023, time.January, 31),
+		now:   day(2023, time.April, 1),
+	},
+}
+
+func TestNextOccurrence(t *testing.T) {
+	for _, tt := range nextOccurrenceTests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			todo := &Todo{
+				UserID:     1,
+				Title:      "Water the plants",
+				Status:     StatusDone,
+				DueAt:      timePtr(tt.dueAt),
+				Recurrence: &rule,
+			}
+			got := NextOccurrence(todo, tt.now)
+			if rule.Occurrence != tt.rule.Occurrence {
+				t.Errorf("the todo's rule was changed to occurrence %d", rule.Occurrence)
+			}
+			if tt.want.IsZero() {
+				if got != nil {
+					t.Fatalf("got a todo due %s; want none", got.DueAt)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("got none; want a todo due %s", tt.want)
+			}
+			if !got.DueAt.Equal(tt.want) {
+				t.Errorf("got due %s; want %s", got.DueAt, tt.want)
+			}
+			if got.Recurrence.Occurrence != tt.wantOccurrence {
+				t.Errorf("got occurrence %d; want %d", got.Recurrence.Occurrence, tt.wantOccurrence)
+			}
+			if got.Status != StatusTodo || got.Title != todo.Title || got.UserID != todo.UserID {
+				t.Errorf("got %+v; want a copy of the todo that isn't done", got)
+			}
+		})
+	}
+}
+
+func TestNextOccurrenceWithoutRule(t *testing.T) {
+	todo := &Todo{DueAt: timePtr(day(2023, time.January, 1))}
+	if got := NextOccurrence(todo, day(2023, time.January, 1)); got != nil {
+		t.Errorf("got %+v; want nil for a todo that doesn't repeat", got)
+	}
+}
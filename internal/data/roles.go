@@ -0,0 +1,123 @@
+// Filename: internal/data/roles.go
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// A Role bundles a set of permission codes
+type Role struct {
+	ID          int64       `json:"id"`
+	Code        string      `json:"code"`
+	Permissions Permissions `json:"permissions"`
+}
+
+type RoleModel struct {
+	DB    *sql.DB
+	Cache *Cache
+}
+
+// GetAll returns every role together with the codes it grants
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := `
+	     SELECT roles.id, roles.code, COALESCE(array_agg(permissions.code ORDER BY permissions.code)
+		        FILTER (WHERE permissions.code IS NOT NULL), '{}')
+		 FROM roles
+		 LEFT JOIN roles_permissions
+		 ON roles_permissions.role_id = roles.id
+		 LEFT JOIN permissions
+		 ON roles_permissions.permission_id = permissions.id
+		 GROUP BY roles.id
+		 ORDER BY roles.code
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+	for rows.Next() {
+		var role Role
+		err := rows.Scan(&role.ID, &role.Code, pq.Array(&role.Permissions))
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, &role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// GetAllForUser returns the codes of the roles a user holds
+func (m RoleModel) GetAllForUser(userID int64) ([]string, error) {
+	query := `
+	     SELECT roles.code
+		 FROM roles
+		 INNER JOIN users_roles
+		 ON users_roles.role_id = roles.id
+		 WHERE users_roles.user_id = $1
+		 ORDER BY roles.code
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// AddForUser gives roles to a user
+func (m RoleModel) AddForUser(userID int64, codes ...string) error {
+	query := `
+	      INSERT INTO users_roles
+		  SELECT $1, roles.id FROM roles WHERE roles.code = ANY($2)
+		  ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	m.Cache.InvalidateUser(userID)
+	return err
+}
+
+// RemoveForUser takes roles away from a user
+func (m RoleModel) RemoveForUser(userID int64, codes ...string) error {
+	query := `
+	      DELETE FROM users_roles
+		  USING roles
+		  WHERE users_roles.role_id = roles.id
+		  AND users_roles.user_id = $1
+		  AND roles.code = ANY($2)
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
+	m.Cache.InvalidateUser(userID)
+	return err
+}
@@ -0,0 +1,417 @@
+// Filename: internal/data/tags.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"alysianorales.net/TODO/internal/validator"
+	"github.com/lib/pq"
+)
+
+var ErrDuplicateTag = errors.New("duplicate tag")
+
+// The ways a todo listing can match the tags it is filtered by
+const (
+	TagMatchAny  = "any"
+	TagMatchAll  = "all"
+	TagMatchNone = "none"
+)
+
+var TagMatches = []string{TagMatchAny, TagMatchAll, TagMatchNone}
+
+// DefaultTagColor is the colour of tags created by tagging a todo
+const DefaultTagColor = "#9e9e9e"
+
+// ColorRX matches the #rrggbb colours that tags can have
+var ColorRX = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// A Tag labels todos. Tags belong to the owner of the todos they are on,
+// so tagging a todo in a shared list uses its owner's tags. Names are
+// unique per owner regardless of case
+type Tag struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	Name       string    `json:"name"`
+	Color      string    `json:"color"`
+	UsageCount int64     `json:"usage_count"`
+	Version    int32     `json:"version"`
+}
+
+// validTagName() reports whether name can be used as a tag. Commas are
+// left out because tags are listed with them in query strings
+func validTagName(name string) bool {
+	return name != "" && len(name) <= 50 && !strings.Contains(name, ",") && name == strings.TrimSpace(name)
+}
+
+func ValidateTag(v *validator.Validator, tag *Tag) {
+	v.Check(tag.Name != "", "name", "must be provided")
+	v.Check(len(tag.Name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(validTagName(tag.Name), "name", "must not contain commas or surrounding spaces")
+	v.Check(validator.Matches(tag.Color, ColorRX), "color", "must be a #rrggbb colour")
+}
+
+// ValidateTodoTags checks the tags of a todo
+func ValidateTodoTags(v *validator.Validator, tags []string) {
+	v.Check(len(tags) <= 20, "tags", "must contain at most 20 tags")
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		v.Check(validTagName(tag), "tags", "must only contain names of 1 to 50 bytes without commas or surrounding spaces")
+		v.Check(!seen[strings.ToLower(tag)], "tags", "must not contain duplicate tags")
+		seen[strings.ToLower(tag)] = true
+	}
+}
+
+// tagsColumn selects the names of a todo's tags along with the todo
+// columns
+const tagsColumn = `ARRAY(SELECT tags.name::text FROM todo_tags INNER JOIN tags ON tags.id = todo_tags.tag_id
+		WHERE todo_tags.todo_id = todo.id ORDER BY tags.name)`
+
+// tagMatchSQL matches the todos tagged with any, all or none of the names
+// in parameter $4, as parameter $17 says. Names are compared rather than
+// tags, so that todos shared by other owners match too
+const tagMatchSQL = `(cardinality($4::citext[]) = 0 OR CASE $17
+		WHEN 'any' THEN EXISTS (SELECT 1 FROM todo_tags INNER JOIN tags ON tags.id = todo_tags.tag_id
+			WHERE todo_tags.todo_id = todo.id AND tags.name = ANY($4::citext[]))
+		WHEN 'none' THEN NOT EXISTS (SELECT 1 FROM todo_tags INNER JOIN tags ON tags.id = todo_tags.tag_id
+			WHERE todo_tags.todo_id = todo.id AND tags.name = ANY($4::citext[]))
+		ELSE NOT EXISTS (SELECT 1 FROM unnest($4::citext[]) AS wanted(name)
+			WHERE NOT EXISTS (SELECT 1 FROM todo_tags INNER JOIN tags ON tags.id = todo_tags.tag_id
+				WHERE todo_tags.todo_id = todo.id AND tags.name = wanted.name))
+		END)`
+
+// tagsScanner reads tagsColumn, leaving an empty slice rather than nil
+// for todos without tags
+type tagsScanner struct {
+	dst *[]string
+}
+
+func (s tagsScanner) Scan(src interface{}) error {
+	var tags []string
+	if err := pq.Array(&tags).Scan(src); err != nil {
+		return err
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	*s.dst = tags
+	return nil
+}
+
+// setTodoTags() makes todo.Tags the tags of the todo using q, creating the
+// ones its owner doesn't have yet. todo.Tags is read back afterwards, so
+// that it is spelt the way the owner's tags are
+func setTodoTags(ctx context.Context, q dbtx, todo *Todo) error {
+	names := pq.Array(todo.Tags)
+	query := `
+		INSERT INTO tags (user_id, name)
+		SELECT $1, unnest($2::citext[])
+		ON CONFLICT (user_id, name) DO NOTHING
+	`
+	if _, err := q.ExecContext(ctx, query, todo.UserID, names); err != nil {
+		return err
+	}
+	query = `
+		DELETE FROM todo_tags
+		WHERE todo_id = $1
+		AND tag_id NOT IN (SELECT id FROM tags WHERE user_id = $2 AND name = ANY($3::citext[]))
+	`
+	if _, err := q.ExecContext(ctx, query, todo.ID, todo.UserID, names); err != nil {
+		return err
+	}
+	query = `
+		INSERT INTO todo_tags (todo_id, tag_id)
+		SELECT $1, id FROM tags WHERE user_id = $2 AND name = ANY($3::citext[])
+		ON CONFLICT DO NOTHING
+	`
+	if _, err := q.ExecContext(ctx, query, todo.ID, todo.UserID, names); err != nil {
+		return err
+	}
+	query = `SELECT ` + tagsColumn + ` FROM todo WHERE id = $1`
+	return q.QueryRowContext(ctx, query, todo.ID).Scan(tagsScanner{&todo.Tags})
+}
+
+// retagTodos() runs change, which alters the tags of the todos tagged with
+// tagIDs, using tx. Those todos get a new version so that clients holding
+// them can tell, and the change is recorded in their history
+func retagTodos(ctx context.Context, tx *sql.Tx, actorID int64, tagIDs []int64, change func() error) error {
+	query := `
+		SELECT ` + todoColumns + `
+		FROM todo
+		WHERE id IN (SELECT todo_id FROM todo_tags WHERE tag_id = ANY($1))
+		FOR UPDATE
+	`
+	olds, err := queryTodos(ctx, tx, query, pq.Array(tagIDs))
+	if err != nil {
+		return err
+	}
+	if err = change(); err != nil {
+		return err
+	}
+	if len(olds) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(olds))
+	byID := make(map[int64]*Todo, len(olds))
+	for i, old := range olds {
+		ids[i] = old.ID
+		byID[old.ID] = old
+	}
+	query = `
+		UPDATE todo
+		SET updated_at = NOW(), version = version + 1
+		WHERE id = ANY($1)
+		RETURNING ` + todoColumns + `
+	`
+	todos, err := queryTodos(ctx, tx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	for _, todo := range todos {
+		if err = recordHistory(ctx, tx, actorID, HistoryUpdate, byID[todo.ID], todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type TagModel struct {
+	DB *sql.DB
+}
+
+// tagColumns lists the columns every tag query selects, in the order that
+// tagDestinations() scans them. The usage count leaves out trashed todos
+const tagColumns = `id, user_id, created_at, name, color, version,
+		(SELECT COUNT(*) FROM todo_tags INNER JOIN todo ON todo.id = todo_tags.todo_id
+			WHERE todo_tags.tag_id = tags.id AND todo.deleted_at IS NULL) AS usage_count`
+
+func tagDestinations(tag *Tag) []interface{} {
+	return []interface{}{
+		&tag.ID,
+		&tag.UserID,
+		&tag.CreatedAt,
+		&tag.Name,
+		&tag.Color,
+		&tag.Version,
+		&tag.UsageCount,
+	}
+}
+
+// isDuplicateTag() reports whether err is the unique constraint on tag
+// names failing
+func isDuplicateTag(err error) bool {
+	return err != nil && err.Error() == `pq: duplicate key value violates unique constraint "tags_user_id_name_key"`
+}
+
+// Insert() creates a tag for tag.UserID
+func (m TagModel) Insert(tag *Tag) error {
+	query := `
+		INSERT INTO tags (user_id, name, color)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, tag.UserID, tag.Name, tag.Color).Scan(&tag.ID, &tag.CreatedAt, &tag.Version)
+	if isDuplicateTag(err) {
+		return ErrDuplicateTag
+	}
+	return err
+}
+
+// Get() returns one of a user's tags
+func (m TagModel) Get(id int64, userID int64) (*Tag, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + tagColumns + `
+		FROM tags
+		WHERE id = $1
+		AND user_id = $2
+	`
+	var tag Tag
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(tagDestinations(&tag)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &tag, nil
+}
+
+// GetAllForUser() returns a page of a user's tags with how many todos
+// each is on
+func (m TagModel) GetAllForUser(userID int64, filters Filters) ([]*Tag, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT COUNT(*) OVER(), `+tagColumns+`
+		FROM tags
+		WHERE user_id = $1
+		ORDER BY %s %s, id ASC
+		LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortOrder())
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	tags := []*Tag{}
+	for rows.Next() {
+		var tag Tag
+		err := rows.Scan(append([]interface{}{&totalRecords}, tagDestinations(&tag)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		tags = append(tags, &tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return tags, metadata, nil
+}
+
+// Update() saves a renamed or recoloured tag, using its version for
+// optimistic locking. A rename shows up as an edit of every todo the tag
+// is on
+func (m TagModel) Update(tag *Tag) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var name string
+	query := `
+		SELECT name FROM tags
+		WHERE id = $1
+		AND user_id = $2
+		AND version = $3
+		FOR UPDATE
+	`
+	err = tx.QueryRowContext(ctx, query, tag.ID, tag.UserID, tag.Version).Scan(&name)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	update := func() error {
+		query := `
+			UPDATE tags
+			SET name = $1, color = $2, version = version + 1
+			WHERE id = $3
+			RETURNING version
+		`
+		err := tx.QueryRowContext(ctx, query, tag.Name, tag.Color, tag.ID).Scan(&tag.Version)
+		if isDuplicateTag(err) {
+			return ErrDuplicateTag
+		}
+		return err
+	}
+	if name != tag.Name {
+		err = retagTodos(ctx, tx, tag.UserID, []int64{tag.ID}, update)
+	} else {
+		err = update()
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete() removes one of a user's tags from its todos and deletes it
+func (m TagModel) Delete(id int64, userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = retagTodos(ctx, tx, userID, []int64{id}, func() error {
+		query := `
+			DELETE FROM tags
+			WHERE id = $1
+			AND user_id = $2
+		`
+		result, err := tx.ExecContext(ctx, query, id, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Merge() moves the todos of the tags in sourceIDs onto target and deletes
+// those tags. Every source has to be another tag of the target's owner
+func (m TagModel) Merge(target *Tag, sourceIDs []int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = retagTodos(ctx, tx, target.UserID, sourceIDs, func() error {
+		query := `
+			INSERT INTO todo_tags (todo_id, tag_id)
+			SELECT todo_id, $1 FROM todo_tags
+			WHERE tag_id = ANY($2)
+			ON CONFLICT DO NOTHING
+		`
+		if _, err := tx.ExecContext(ctx, query, target.ID, pq.Array(sourceIDs)); err != nil {
+			return err
+		}
+		query = `
+			DELETE FROM tags
+			WHERE id = ANY($1)
+			AND id <> $2
+			AND user_id = $3
+		`
+		result, err := tx.ExecContext(ctx, query, pq.Array(sourceIDs), target.ID, target.UserID)
+		if err != nil {
+			return err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows != int64(len(sourceIDs)) {
+			return ErrRecordNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
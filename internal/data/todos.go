@@ -7,24 +7,113 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"alysianorales.net/TODO/internal/validator"
 	"github.com/lib/pq"
 )
 
+// The statuses a todo can be in
+const (
+	StatusTodo       = "todo"
+	StatusInProgress = "in_progress"
+	StatusBlocked    = "blocked"
+	StatusDone       = "done"
+	StatusCancelled  = "cancelled"
+)
+
+var Statuses = []string{StatusTodo, StatusInProgress, StatusBlocked, StatusDone, StatusCancelled}
+
+// The priorities a todo can have, from least to most pressing
+const (
+	PriorityLow    = "low"
+	PriorityNormal = "normal"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+var Priorities = []string{PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent}
+
+// statusTransitions lists the statuses each status may move to. Finished
+// todos can only be reopened
+var statusTransitions = map[string][]string{
+	StatusTodo:       {StatusInProgress, StatusBlocked, StatusDone, StatusCancelled},
+	StatusInProgress: {StatusTodo, StatusBlocked, StatusDone, StatusCancelled},
+	StatusBlocked:    {StatusTodo, StatusInProgress, StatusCancelled},
+	StatusDone:       {StatusTodo},
+	StatusCancelled:  {StatusTodo},
+}
+
+// ValidateStatusTransition checks that a todo may move between two statuses
+func ValidateStatusTransition(v *validator.Validator, from, to string) {
+	if from == to {
+		return
+	}
+	v.Check(validator.In(to, statusTransitions[from]...), "status", fmt.Sprintf("cannot move from %s to %s", from, to))
+}
+
 type Todo struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Label     string    `json:"label"`
-	Task      string    `json:"task"`
-	Priority  string    `json:"priority"`
-	Status    string    `json:"status,omitempty"`
-	Website   string    `json:"website,omitempty"`
-	Address   string    `json:"address"`
-	Mode      []string  `json:"mode"`
-	Version   int32     `json:"version"`
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	UserID      int64       `json:"user_id"`
+	ParentID    *int64      `json:"parent_id,omitempty"`
+	ListID      *int64      `json:"list_id,omitempty"`
+	AssigneeID  *int64      `json:"assignee_id,omitempty"`
+	Title       string      `json:"title"`
+	Label       string      `json:"label"`
+	Task        string      `json:"task"`
+	Priority    string      `json:"priority"`
+	Status      string      `json:"status,omitempty"`
+	Website     string      `json:"website,omitempty"`
+	Address     string      `json:"address"`
+	Tags        []string    `json:"tags"`
+	DueAt       *time.Time  `json:"due_at,omitempty"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+	Recurrence  *Recurrence `json:"recurrence,omitempty"`
+	DeletedAt   *time.Time  `json:"deleted_at,omitempty"`
+	Version     int32       `json:"version"`
+}
+
+// todoColumns lists the columns every todo query selects, in the order
+// that todoDestinations() scans them
+const todoColumns = `todo.id, created_at, updated_at, user_id, parent_id, list_id, assignee_id, title, label, task, priority,
+		status, website, address, ` + tagsColumn + `, due_at, completed_at, ` + recurrenceColumn + `, deleted_at, version`
+
+// todoDestinations() returns the scan targets for todoColumns
+func todoDestinations(todo *Todo) []interface{} {
+	return []interface{}{
+		&todo.ID,
+		&todo.CreatedAt,
+		&todo.UpdatedAt,
+		&todo.UserID,
+		&todo.ParentID,
+		&todo.ListID,
+		&todo.AssigneeID,
+		&todo.Title,
+		&todo.Label,
+		&todo.Task,
+		&todo.Priority,
+		&todo.Status,
+		&todo.Website,
+		&todo.Address,
+		tagsScanner{&todo.Tags},
+		&todo.DueAt,
+		&todo.CompletedAt,
+		recurrenceScanner{&todo.Recurrence},
+		&todo.DeletedAt,
+		&todo.Version,
+	}
+}
+
+// todoAccess() returns the condition matching the todos that the user in
+// parameter $n can see: their own and those in the lists they are a member
+// of. A user of 0 matches every todo
+func todoAccess(n int) string {
+	return fmt.Sprintf(`(todo.user_id = $%[1]d OR $%[1]d = 0
+		OR todo.list_id IN (SELECT list_id FROM list_members WHERE list_members.user_id = $%[1]d))`, n)
 }
 
 func ValidateList(v *validator.Validator, todo *Todo) {
@@ -39,10 +128,10 @@ func ValidateList(v *validator.Validator, todo *Todo) {
 	v.Check(len(todo.Task) <= 200, "task", "must not be more than 200 bytes long")
 
 	v.Check(todo.Priority != "", "priority", "must be provided")
-	//v.Check(validator.Matches(todo.Priority, validator.PriorityRX), "priority", "must be a valid priority number")
+	v.Check(validator.In(todo.Priority, Priorities...), "priority", "must be one of "+strings.Join(Priorities, ", "))
 
 	v.Check(todo.Status != "", "status", "must be provided")
-	//v.Check(validator.Matches(todo.Status, validator.StatusRX), "status", "must be a valid status")
+	v.Check(validator.In(todo.Status, Statuses...), "status", "must be one of "+strings.Join(Statuses, ", "))
 
 	v.Check(todo.Website != "", "website", "must be provided")
 	v.Check(validator.ValidWebsite(todo.Website), "website", "must be a valid url")
@@ -50,69 +139,114 @@ func ValidateList(v *validator.Validator, todo *Todo) {
 	v.Check(todo.Address != "", "address", "must be provided")
 	v.Check(len(todo.Address) <= 500, "address", "must not be more than 500 bytes long")
 
-	v.Check(todo.Mode != nil, "mode", "must be provided")
-	v.Check(len(todo.Mode) >= 1, "mode", "must contain at least one todos")
-	v.Check(len(todo.Mode) <= 5, "mode", "must contain at most 5 todos")
-	v.Check(validator.Unique(todo.Mode), "mode", "must not contain duplicate todos")
+	ValidateTodoTags(v, todo.Tags)
+
+	//A new todo can't already be late; an existing one can't fall due
+	//before it was created
+	if todo.DueAt != nil {
+		if todo.CreatedAt.IsZero() {
+			v.Check(todo.DueAt.After(time.Now()), "due_at", "must be in the future")
+		} else {
+			v.Check(todo.DueAt.After(todo.CreatedAt), "due_at", "must be later than created_at")
+		}
+	}
+
+	if todo.Recurrence != nil {
+		ValidateRecurrence(v, todo.Recurrence, todo.DueAt)
+	}
 }
 
-// Define a ListModel which wraps a sql.DB connection pool
+// Define a ListModel which wraps a sql.DB connection pool. ActorID is the
+// user that the changes made through the model are recorded against
 type TodoModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	ActorID int64
+}
+
+// The As() method returns a copy of the model that records its changes in
+// the todo history as made by userID
+func (m TodoModel) As(userID int64) TodoModel {
+	m.ActorID = userID
+	return m
 }
 
-// Insert () allows us to create a new List
+// Insert () allows us to create a new List owned by todo.UserID
 func (m TodoModel) Insert(todo *Todo) error {
-	query := `
-	INSERT INTO todo (title, label, task, priority, status, website, address, mode)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	RETURNING id, created_at, version
-	`
 	//Create a context
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	//Cleanup to prevent memory leaks
 	defer cancel()
+	//The todo and its recurrence rule are stored together
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = insertTodo(ctx, tx, m.ActorID, todo); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertTodo() adds a todo and its recurrence rule using q, recording it
+// in the history as created by actorID
+func insertTodo(ctx context.Context, q dbtx, actorID int64, todo *Todo) error {
+	query := `
+	INSERT INTO todo (title, label, task, priority, status, website, address, user_id, due_at, parent_id, list_id, assignee_id, completed_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, CASE WHEN $5 = 'done' THEN NOW() END)
+	RETURNING id, created_at, updated_at, completed_at, version
+	`
 	//Collect data fields into a slice
 	args := []interface{}{
 		todo.Title, todo.Label, todo.Task,
 		todo.Priority, todo.Status, todo.Website,
-		todo.Address, pq.Array(todo.Mode),
+		todo.Address, todo.UserID,
+		todo.DueAt, todo.ParentID, todo.ListID, todo.AssigneeID,
 	}
-	return m.DB.QueryRowContext(ctx, query, args...).Scan(&todo.ID, &todo.CreatedAt, &todo.Version)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&todo.ID, &todo.CreatedAt, &todo.UpdatedAt, &todo.CompletedAt, &todo.Version)
+	if err != nil {
+		return err
+	}
+	if todo.Recurrence != nil {
+		if err = setRecurrence(ctx, q, todo.ID, todo.Recurrence); err != nil {
+			return err
+		}
+	}
+	if err = setTodoTags(ctx, q, todo); err != nil {
+		return err
+	}
+	return recordHistory(ctx, q, actorID, HistoryCreate, nil, todo)
 }
 
-//Get() allows us to retrieve a specific List
-func (m TodoModel) Get(id int64) (*Todo, error) {
+//Get() allows us to retrieve a specific List that ownerID can see, either
+//their own or one in a list they are a member of.
+//An ownerID of 0 matches every owner
+func (m TodoModel) Get(id int64, ownerID int64) (*Todo, error) {
 	//Ensure that there is a valid id
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
+	//Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	//Cleanup to prevent memory leaks
+	defer cancel()
+	return getTodo(ctx, m.DB, id, ownerID)
+}
+
+// getTodo() fetches a todo that ownerID can see using q
+func getTodo(ctx context.Context, q dbtx, id int64, ownerID int64) (*Todo, error) {
 	//Create the query
 	query := `
-		SELECT id, created_at, title, label, task, priority, status, website, address, mode, version
+		SELECT ` + todoColumns + `
 		FROM todo
 		WHERE id = $1
+		AND ` + todoAccess(2) + `
+		AND deleted_at IS NULL
 	`
 	//Declare a Todo variable to hold the returned data
 	var todo Todo
-	//Create a context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	//Cleanup to prevent memory leaks
-	defer cancel()
 	//Exexcute the query using QueryRow()
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(
-		&todo.ID,
-		&todo.CreatedAt,
-		&todo.Title,
-		&todo.Label,
-		&todo.Task,
-		&todo.Priority,
-		&todo.Status,
-		&todo.Website,
-		&todo.Address,
-		pq.Array(&todo.Mode),
-		&todo.Version,
-	)
+	err := q.QueryRowContext(ctx, query, id, ownerID).Scan(todoDestinations(&todo)...)
 	//Handle any errors
 	if err != nil {
 		//Check the type of error
@@ -127,23 +261,90 @@ func (m TodoModel) Get(id int64) (*Todo, error) {
 	return &todo, nil
 }
 
-//Update() allows us to edit/alter a specific List
+//Update() allows us to edit/alter a specific List belonging to ownerID
 //Optimistic locking (version number)
-func (m TodoModel) Update(todo *Todo) error {
+func (m TodoModel) Update(todo *Todo, ownerID int64) error {
+	//Create a context
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	//Cleanup to prevent memory leaks
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = updateTodo(ctx, tx, m.ActorID, todo, ownerID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// The CompleteRecurring() method saves a recurring todo that has just been
+// marked done and creates the next todo in its series. The rule moves to
+// the new todo, so a series only ever has one open todo. The new todo is
+// nil when the series has ended
+func (m TodoModel) CompleteRecurring(todo *Todo, ownerID int64) (*Todo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	next, err := completeRecurring(ctx, tx, m.ActorID, todo, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	return next, tx.Commit()
+}
+
+// completeRecurring() does the work of CompleteRecurring() using q
+func completeRecurring(ctx context.Context, q dbtx, actorID int64, todo *Todo, ownerID int64) (*Todo, error) {
+	next := NextOccurrence(todo, time.Now())
+	todo.Recurrence = nil
+	if err := updateTodo(ctx, q, actorID, todo, ownerID); err != nil {
+		return nil, err
+	}
+	if next != nil {
+		if err := insertTodo(ctx, q, actorID, next); err != nil {
+			return nil, err
+		}
+	}
+	return next, nil
+}
+
+// updateTodo() saves a todo and its recurrence rule using q, recording
+// the fields that changed in the history
+func updateTodo(ctx context.Context, q dbtx, actorID int64, todo *Todo, ownerID int64) error {
+	//The saved todo is the "before" side of the history diff. If it has
+	//moved on from the version being saved, this is an edit conflict
+	old, err := getTodo(ctx, q, todo.ID, ownerID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	if old.Version != todo.Version {
+		return ErrEditConflict
+	}
 	//Create a query
 	query := `
 		UPDATE todo
 		SET title = $1, label = $2, task = $3, 
 			priority = $4, status = $5, website = $6, 
-			address = $7, mode = $8, version = version + 1
+			address = $7, due_at = $8, list_id = $12, assignee_id = $13,
+			completed_at = CASE WHEN $5 = 'done' THEN COALESCE(completed_at, NOW()) END,
+			reminded_at = CASE WHEN due_at IS DISTINCT FROM $8 THEN NULL ELSE reminded_at END,
+			updated_at = NOW(), version = version + 1
 		WHERE id = $9
-		AND version = $10		
-		RETURNING version
+		AND version = $10
+		AND ` + todoAccess(11) + `
+		AND deleted_at IS NULL
+		RETURNING updated_at, completed_at, version
 	`
-	//Create a context
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	//Cleanup to prevent memory leaks
-	defer cancel()
 
 	args := []interface{}{
 		todo.Title,
@@ -153,12 +354,15 @@ func (m TodoModel) Update(todo *Todo) error {
 		todo.Status,
 		todo.Website,
 		todo.Address,
-		pq.Array(todo.Mode),
+		todo.DueAt,
 		todo.ID,
 		todo.Version,
+		ownerID,
+		todo.ListID,
+		todo.AssigneeID,
 	}
 	//Check for edit conflicts
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&todo.Version)
+	err = q.QueryRowContext(ctx, query, args...).Scan(&todo.UpdatedAt, &todo.CompletedAt, &todo.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -167,61 +371,348 @@ func (m TodoModel) Update(todo *Todo) error {
 			return err
 		}
 	}
-	return nil
+	if err = setRecurrence(ctx, q, todo.ID, todo.Recurrence); err != nil {
+		return err
+	}
+	if err = setTodoTags(ctx, q, todo); err != nil {
+		return err
+	}
+	//Subtasks go with their parent when it moves to another list
+	if !SameList(old.ListID, todo.ListID) {
+		if err = moveSubtasks(ctx, q, actorID, todo.ID, old.ListID, todo.ListID); err != nil {
+			return err
+		}
+	}
+	return recordHistory(ctx, q, actorID, HistoryUpdate, old, todo)
 }
 
-//Delete() removes a specific List
-func (m TodoModel) Delete(id int64) error {
-	//Ensure that there is a valid id
-	if id < 1 {
-		return ErrRecordNotFound
+// SameList() reports whether two list ids name the same list, or are
+// both unset
+func SameList(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == b
 	}
-	//Create the delete query
+	return *a == *b
+}
+
+// moveSubtasks() moves every descendant of a todo from one list to another
+// using q, recording each move in the history
+func moveSubtasks(ctx context.Context, q dbtx, actorID int64, todoID int64, from, to *int64) error {
 	query := `
-		DELETE FROM todo
-		WHERE id = $1
+		WITH RECURSIVE tree(id) AS (
+			SELECT id FROM todo WHERE parent_id = $1
+			UNION
+			SELECT todo.id FROM todo
+			INNER JOIN tree ON todo.parent_id = tree.id
+		)
+		UPDATE todo
+		SET list_id = $2, updated_at = NOW(), version = version + 1
+		WHERE id IN (SELECT id FROM tree)
+		RETURNING ` + todoColumns + `
 	`
+	todos, err := queryTodos(ctx, q, query, todoID, to)
+	if err != nil {
+		return err
+	}
+	for _, todo := range todos {
+		old := *todo
+		old.ListID = from
+		if err = recordHistory(ctx, q, actorID, HistoryUpdate, &old, todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Delete() moves a specific List belonging to ownerID to the trash.
+//Optimistic locking (version number)
+func (m TodoModel) Delete(todo *Todo, ownerID int64) error {
 	//Create a context
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	//Cleanup to prevent memory leaks
 	defer cancel()
-	//Execute the query.
-	result, err := m.DB.ExecContext(ctx, query, id)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	//Check how many rows were affected by the delete operation.
-	//Call the RowsAffected() method on the result variable
-	rowsAffected, err := result.RowsAffected()
+	defer tx.Rollback()
+	if err = deleteTodo(ctx, tx, m.ActorID, todo, ownerID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteTodo() moves a todo belonging to ownerID, and its subtasks, to
+// the trash using q. They share a deleted_at so that they can be restored
+// together. Each todo moved is recorded in the history
+func deleteTodo(ctx context.Context, q dbtx, actorID int64, todo *Todo, ownerID int64) error {
+	//Create the delete query
+	query := `
+		WITH RECURSIVE tree(id) AS (
+			SELECT id FROM todo
+			WHERE id = $1
+			AND version = $3
+			AND ` + todoAccess(2) + `
+			AND deleted_at IS NULL
+			UNION
+			SELECT todo.id FROM todo
+			INNER JOIN tree ON todo.parent_id = tree.id
+			WHERE todo.deleted_at IS NULL
+		)
+		UPDATE todo
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id IN (SELECT id FROM tree)
+		RETURNING ` + todoColumns + `
+	`
+	//Execute the query.
+	todos, err := queryTodos(ctx, q, query, todo.ID, ownerID, todo.Version)
 	if err != nil {
 		return err
 	}
-	//Check if no rows were affected
-	if rowsAffected == 0 {
-		return ErrRecordNotFound
+	//Someone changed or deleted the todo since it was read
+	if len(todos) == 0 {
+		return ErrEditConflict
+	}
+	for _, todo := range todos {
+		old := *todo
+		old.DeletedAt = nil
+		if err = recordHistory(ctx, q, actorID, HistoryDelete, &old, todo); err != nil {
+			return err
+		}
 	}
 	return nil
+}
+
+// TodoTx runs todo queries inside a single transaction, so that a batch
+// of changes is applied all together or not at all
+type TodoTx struct {
+	ctx     context.Context
+	tx      *sql.Tx
+	actorID int64
+}
+
+// The BeginTx() method starts a transaction that lasts until ctx is done
+func (m TodoModel) BeginTx(ctx context.Context) (*TodoTx, error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &TodoTx{ctx: ctx, tx: tx, actorID: m.ActorID}, nil
+}
+
+func (t *TodoTx) Insert(todo *Todo) error {
+	return insertTodo(t.ctx, t.tx, t.actorID, todo)
+}
+
+func (t *TodoTx) Get(id int64, ownerID int64) (*Todo, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	return getTodo(t.ctx, t.tx, id, ownerID)
+}
+
+func (t *TodoTx) Update(todo *Todo, ownerID int64) error {
+	return updateTodo(t.ctx, t.tx, t.actorID, todo, ownerID)
+}
+
+func (t *TodoTx) CompleteRecurring(todo *Todo, ownerID int64) (*Todo, error) {
+	return completeRecurring(t.ctx, t.tx, t.actorID, todo, ownerID)
+}
+
+func (t *TodoTx) OpenBlockers(todoID int64) (int, error) {
+	return openBlockers(t.ctx, t.tx, todoID)
+}
+
+func (t *TodoTx) Delete(todo *Todo, ownerID int64) error {
+	return deleteTodo(t.ctx, t.tx, t.actorID, todo, ownerID)
+}
+
+func (t *TodoTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *TodoTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// TodoReminder is a todo that is about to fall due, along with the
+// owner who should be told about it
+type TodoReminder struct {
+	TodoID int64
+	Title  string
+	DueAt  time.Time
+	Name   string
+	Email  string
+}
+
+// The ClaimReminders() method marks the open todos falling due within the
+// window as reminded and returns them. Claiming and returning happen in one
+// statement, so a todo is only handed out once per due date unless it is
+// unclaimed. Todos of accounts that aren't activated yet are left for later
+func (m TodoModel) ClaimReminders(window time.Duration) ([]*TodoReminder, error) {
+	query := `
+		WITH due AS (
+			UPDATE todo
+			SET reminded_at = NOW()
+			WHERE due_at IS NOT NULL
+			AND due_at <= NOW() + make_interval(secs => $1)
+			AND reminded_at IS NULL
+			AND status NOT IN ('done', 'cancelled')
+			AND deleted_at IS NULL
+			AND user_id IN (SELECT id FROM users WHERE activated)
+			RETURNING id, title, due_at, user_id
+		)
+		SELECT due.id, due.title, due.due_at, users.name, users.email
+		FROM due
+		INNER JOIN users ON users.id = due.user_id
+		ORDER BY due.due_at
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, window.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reminders := []*TodoReminder{}
+	for rows.Next() {
+		var reminder TodoReminder
+		err := rows.Scan(&reminder.TodoID, &reminder.Title, &reminder.DueAt, &reminder.Name, &reminder.Email)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, &reminder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reminders, nil
+}
 
+// The UnclaimReminder() method hands a claimed reminder back, so that the
+// next check tries it again
+func (m TodoModel) UnclaimReminder(todoID int64) error {
+	query := `
+		UPDATE todo
+		SET reminded_at = NULL
+		WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, todoID)
+	return err
+}
+
+// TodoSearch holds the criteria a todo listing is filtered by. Empty
+// fields match every todo
+type TodoSearch struct {
+	OwnerID       int64 // 0 matches every owner
+	ListID        int64 // 0 matches every list
+	AssigneeID    int64 // 0 matches every todo, assigned or not
+	Title         string
+	Label         string
+	Address       string
+	Status        string
+	Priority      string
+	// Tags are matched by name according to TagMatch
+	Tags          []string
+	TagMatch      string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	DueBefore     *time.Time
+	// Overdue matches open todos whose due date has passed
+	Overdue bool
+	// Query is a full-text search over the title, task, label and address
+	Query string
 }
 
-//The GetAll() method returns a list of all the todos sorted by id
-func (m TodoModel) GetAll(title string, label string, mode []string, filters Filters) ([]*Todo, Metadata, error) {
+func ValidateTodoSearch(v *validator.Validator, s TodoSearch, f Filters) {
+	if s.Status != "" {
+		v.Check(validator.In(s.Status, Statuses...), "status", "must be one of "+strings.Join(Statuses, ", "))
+	}
+	if s.Priority != "" {
+		v.Check(validator.In(s.Priority, Priorities...), "priority", "must be one of "+strings.Join(Priorities, ", "))
+	}
+	v.Check(len(s.Query) <= 200, "q", "must not be more than 200 bytes long")
+	if len(s.Tags) > 0 {
+		v.Check(validator.In(s.TagMatch, TagMatches...), "tag_match", "must be one of "+strings.Join(TagMatches, ", "))
+	}
+	if s.CreatedAfter != nil && s.CreatedBefore != nil {
+		v.Check(s.CreatedAfter.Before(*s.CreatedBefore), "created_before", "must be later than created_after")
+	}
+	if s.Overdue {
+		v.Check(s.Status != StatusDone && s.Status != StatusCancelled, "status", "cannot be a closed status when filtering overdue todos")
+	}
+	//Relevance only means something for a full-text search, and the
+	//rank can't be used as a cursor key
+	if f.Sort == "-relevance" {
+		v.Check(s.Query != "", "sort", "relevance sorting needs a q search")
+		v.Check(f.Cursor == "", "cursor", "cannot be used when sorting by relevance")
+	}
+	//A cursor's key has to be a value of the sort column, or the query
+	//would fail on it
+	if f.Cursor != "" && f.Sort != "-relevance" && validator.In(f.Sort, f.SortList...) {
+		if c, err := decodeCursor(f.Cursor); err == nil {
+			v.Check(validCursorKey(f.sortColumn(), c.Key), "cursor", "invalid cursor")
+		}
+	}
+}
+
+//The GetAll() method returns a list of the todos that match the search
+//sorted by id. The listing is paged with page/page_size, or walked with a
+//cursor when filters.Cursor is set
+func (m TodoModel) GetAll(search TodoSearch, filters Filters) ([]*Todo, Metadata, error) {
+	//Counting every match is what makes deep pages slow, so keyset mode skips it
+	count := "COUNT (*) OVER()"
+	if filters.usesCursor() {
+		count = "0"
+	}
+	//Relevance is the rank of the full-text match on the weighted search
+	//column, and priorities sort by how pressing they are
+	orderBy := filters.sortColumn()
+	switch orderBy {
+	case "relevance":
+		orderBy = "ts_rank(search, plainto_tsquery('simple', $9))"
+	case "priority":
+		orderBy = priorityRankSQL
+	case "due_at":
+		orderBy = dueAtSQL
+	}
 	//Construct the query
 	query := fmt.Sprintf(`
-		SELECT COUNT (*) OVER(), id, created_at, title, 
-				label, task,priority, 
-				status, website, address, mode, version
+		SELECT %s, %s
 		FROM todo
-		WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		WHERE deleted_at IS NULL
+		AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '')
 		AND (to_tsvector('simple', label) @@ plainto_tsquery('simple', $2) OR $2 = '')
-		AND (mode @> $3 OR $3 = '{}' )
-		ORDER BY %s %s, id ASC
-		LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortOrder())
+		AND (to_tsvector('simple', address) @@ plainto_tsquery('simple', $3) OR $3 = '')
+		AND ` + tagMatchSQL + `
+		AND (status = $5 OR $5 = '')
+		AND (priority = $6 OR $6 = '')
+		AND (created_at >= $7 OR $7 IS NULL)
+		AND (created_at < $8 OR $8 IS NULL)
+		AND (search @@ plainto_tsquery('simple', $9) OR $9 = '')
+		AND ` + todoAccess(10) + `
+		AND (due_at < $13 OR $13 IS NULL)
+		AND ((due_at < NOW() AND status NOT IN ('done', 'cancelled')) OR NOT $14)
+		AND (list_id = $15 OR $15 = 0)
+		AND (assignee_id = $16 OR $16 = 0)
+		%s
+		ORDER BY %s %s, id %s
+		LIMIT $11 OFFSET $12`, count, todoColumns, filters.keysetCondition(orderBy, 18),
+		orderBy, filters.queryOrder(), filters.idOrder())
 	//Create a 3-second-timeout context
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	//Execute the query
-	args := []interface{}{title, label, pq.Array(mode), filters.limit(), filters.offset()}
+	args := []interface{}{
+		search.Title, search.Label, search.Address, pq.Array(search.Tags),
+		search.Status, search.Priority, search.CreatedAfter, search.CreatedBefore,
+		search.Query, search.OwnerID, filters.queryLimit(), filters.queryOffset(),
+		search.DueBefore, search.Overdue, search.ListID,
+		search.AssigneeID, search.TagMatch,
+	}
+	args = append(args, filters.keysetArgs()...)
 	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
@@ -235,20 +726,7 @@ func (m TodoModel) GetAll(title string, label string, mode []string, filters Fil
 	for rows.Next() {
 		var todo Todo
 		//Scan the values from the row into Todo
-		err := rows.Scan(
-			&totalRecords,
-			&todo.ID,
-			&todo.CreatedAt,
-			&todo.Title,
-			&todo.Label,
-			&todo.Task,
-			&todo.Priority,
-			&todo.Status,
-			&todo.Website,
-			&todo.Address,
-			pq.Array(&todo.Mode),
-			&todo.Version,
-		)
+		err := rows.Scan(append([]interface{}{&totalRecords}, todoDestinations(&todo)...)...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -259,7 +737,101 @@ func (m TodoModel) GetAll(title string, label string, mode []string, filters Fil
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
+	//In keyset mode the extra row tells us whether there is another page
+	hasMore := false
+	if filters.usesCursor() {
+		hasMore = len(todos) > filters.limit()
+		if hasMore {
+			todos = todos[:filters.limit()]
+		}
+		//Rows fetched backwards come out in reverse
+		if filters.cursor().Backward {
+			for i, j := 0, len(todos)-1; i < j; i, j = i+1, j-1 {
+				todos[i], todos[j] = todos[j], todos[i]
+			}
+		}
+	}
 	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	if len(todos) > 0 && filters.sortColumn() != "relevance" {
+		column := filters.sortColumn()
+		first, last := todos[0].cursor(column), todos[len(todos)-1].cursor(column)
+		metadata = filters.calculateCursors(metadata, hasMore, first, last)
+	}
 	//Return the slice of Lists
 	return todos, metadata, nil
 }
+
+// The cursor() method returns the position of the todo in a listing
+// sorted by column
+func (todo *Todo) cursor(column string) Cursor {
+	c := Cursor{ID: todo.ID}
+	switch column {
+	case "id":
+		c.Key = strconv.FormatInt(todo.ID, 10)
+	case "title":
+		c.Key = todo.Title
+	case "label":
+		c.Key = todo.Label
+	case "task":
+		c.Key = todo.Task
+	case "status":
+		c.Key = todo.Status
+	case "priority":
+		c.Key = strconv.Itoa(priorityRank(todo.Priority))
+	case "created_at":
+		c.Key = todo.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		c.Key = todo.UpdatedAt.Format(time.RFC3339Nano)
+	case "due_at":
+		c.Key = "infinity"
+		if todo.DueAt != nil {
+			c.Key = todo.DueAt.Format(time.RFC3339Nano)
+		}
+	default:
+		panic("no cursor key for sort column: " + column)
+	}
+	return c
+}
+
+// validCursorKey() reports whether key could have come from cursor() for
+// a listing sorted by column. Clients can edit cursors, so the key is
+// checked against the column's type before it reaches the query
+func validCursorKey(column, key string) bool {
+	switch column {
+	case "id":
+		_, err := strconv.ParseInt(key, 10, 64)
+		return err == nil
+	case "priority":
+		_, err := strconv.ParseInt(key, 10, 32)
+		return err == nil
+	case "created_at", "updated_at":
+		_, err := time.Parse(time.RFC3339Nano, key)
+		return err == nil
+	case "due_at":
+		if key == "infinity" {
+			return true
+		}
+		_, err := time.Parse(time.RFC3339Nano, key)
+		return err == nil
+	default:
+		// Postgres text can hold anything but a NUL byte
+		return !strings.ContainsRune(key, 0)
+	}
+}
+
+// dueAtSQL sorts todos without a due date after every dated one, so the
+// column can still be used as a cursor key
+const dueAtSQL = "COALESCE(due_at, 'infinity')"
+
+// priorityRankSQL orders priorities from least to most pressing
+const priorityRankSQL = "array_position(ARRAY['low', 'normal', 'high', 'urgent'], priority)"
+
+// priorityRank() mirrors priorityRankSQL for building cursors
+func priorityRank(priority string) int {
+	for i := range Priorities {
+		if Priorities[i] == priority {
+			return i + 1
+		}
+	}
+	return 0
+}
@@ -8,9 +8,11 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"time"
 
 	"alysianorales.net/TODO/internal/validator"
+	"github.com/lib/pq"
 )
 
 // Token categories/scopes
@@ -18,23 +20,36 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeRefresh        = "refresh"
+	ScopePasswordReset  = "password-reset"
+	ScopeEmailChange    = "email-change"
+)
+
+var (
+	ErrTokenReused = errors.New("token reused")
 )
 
 // Define the token type
 type Token struct {
-	Plaintext string    `json: "token"`
-	Hash      []byte    `json: "-"`
-	UserID    int64     `json: "-"`
-	Expiry    time.Time `json: "expiry"`
-	Scope     string    `json: "-"`
+	Plaintext  string     `json:"token,omitempty"`
+	Hash       []byte     `json:"-"`
+	UserID     int64      `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Expiry     time.Time  `json:"expiry"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	UserAgent  string     `json:"user_agent,omitempty"`
+	Scope      string     `json:"-"`
+	Family     []byte     `json:"-"`
+	Current    bool       `json:"current,omitempty"`
 }
 
 // The generate token function returns a token
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
 	token := &Token{
-		UserID: userID,
-		Expiry: time.Now().Add(ttl),
-		Scope:  scope,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+		Expiry:    time.Now().Add(ttl),
+		Scope:     scope,
 	}
 	// Create a byte slice to hold random values and fill it with values
 	// from the CSPRNG
@@ -48,6 +63,8 @@ func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error
 	// Hash the string token
 	hash := sha256.Sum256([]byte(token.Plaintext))
 	token.Hash = hash[:]
+	// A token starts out as the only member of its own family
+	token.Family = token.Hash
 
 	return token, nil
 }
@@ -60,7 +77,8 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 
 // Define the token model
 type TokenModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *Cache
 }
 
 // Create and insert a Token into the tokens table
@@ -73,25 +91,157 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewPair creates a short-lived authentication token and the refresh token
+// that can be exchanged for its successor
+func (m TokenModel) NewPair(userID int64, accessTTL, refreshTTL time.Duration, userAgent string) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	access, refresh, err := insertPair(ctx, tx, userID, accessTTL, refreshTTL, userAgent, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return access, refresh, tx.Commit()
+}
+
+// insertPair generates and inserts a token pair. A nil family starts a new
+// one
+func insertPair(ctx context.Context, q dbtx, userID int64, accessTTL, refreshTTL time.Duration, userAgent string, family []byte) (*Token, *Token, error) {
+	access, err := generateToken(userID, accessTTL, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+	refresh, err := generateToken(userID, refreshTTL, ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+	if family == nil {
+		family = refresh.Hash
+	}
+	for _, token := range []*Token{access, refresh} {
+		token.UserAgent = userAgent
+		token.Family = family
+		err = insertToken(ctx, q, token)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return access, refresh, nil
+}
+
+// Refresh exchanges a refresh token for a successor pair in the same
+// family. Spending the token, removing the family's old authentication
+// tokens and issuing the pair happen in one transaction, so a failure
+// leaves the old token usable. Presenting an already spent token revokes
+// the whole family
+func (m TokenModel) Refresh(tokenPlaintext string, accessTTL, refreshTTL time.Duration, userAgent string) (*Token, *Token, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		UPDATE tokens
+		SET used_at = NOW()
+		WHERE hash = $1
+		AND scope = $2
+		AND used_at IS NULL
+		AND expiry > $3
+		RETURNING family, user_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var family []byte
+	var userID int64
+	err = tx.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh, time.Now()).Scan(&family, &userID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, nil, err
+		}
+		// Check whether the token has been spent before
+		query = `
+			SELECT family
+			FROM tokens
+			WHERE hash = $1
+			AND scope = $2
+			AND used_at IS NOT NULL
+		`
+		err = tx.QueryRowContext(ctx, query, tokenHash[:], ScopeRefresh).Scan(&family)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return nil, nil, ErrRecordNotFound
+			default:
+				return nil, nil, err
+			}
+		}
+		tx.Rollback()
+		err = m.DeleteFamily(family)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrTokenReused
+	}
+
+	query = `
+		DELETE FROM tokens
+		WHERE family = $1 AND scope = $2
+	`
+	_, err = tx.ExecContext(ctx, query, family, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+	access, refresh, err := insertPair(ctx, tx, userID, accessTTL, refreshTTL, userAgent, family)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, nil, err
+	}
+	m.Cache.InvalidateUser(userID)
+	return access, refresh, nil
+}
+
 // Insert will insert an entry into the tokens table
 func (m TokenModel) Insert(token *Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertToken(ctx, m.DB, token)
+}
+
+// insertToken runs the insert on either the pool or a transaction
+func insertToken(ctx context.Context, db dbtx, token *Token) error {
 	query := `
-		INSERT INTO tokens (hash, user_id, expiry, scope)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO tokens (hash, user_id, created_at, expiry, scope, user_agent, family)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
 	`
 
 	args := []interface{}{
 		token.Hash,
 		token.UserID,
+		token.CreatedAt,
 		token.Expiry,
 		token.Scope,
+		token.UserAgent,
+		token.Family,
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	_, err := db.ExecContext(ctx, query, args...)
 	return err
 }
+
 func (m TokenModel) DeleteAllForUsers(scope string, userID int64) error {
 	query := `
 		DELETE FROM tokens
@@ -102,5 +252,151 @@ func (m TokenModel) DeleteAllForUsers(scope string, userID int64) error {
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	m.Cache.InvalidateUser(userID)
 	return err
 }
+
+// DeleteAllScopesForUser removes every token the user holds, whatever its scope
+func (m TokenModel) DeleteAllScopesForUser(userID int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID)
+	m.Cache.InvalidateUser(userID)
+	return err
+}
+
+// DeleteOtherSessions signs the user out everywhere but the session that
+// tokenPlaintext belongs to. The authentication and refresh tokens of every
+// other family go, along with any password reset tokens
+func (m TokenModel) DeleteOtherSessions(userID int64, tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $1
+		AND scope = ANY($2)
+		AND family IS DISTINCT FROM (SELECT family FROM tokens WHERE hash = $3)
+	`
+	scopes := []string{ScopeAuthentication, ScopeRefresh, ScopePasswordReset}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(scopes), tokenHash[:])
+	m.Cache.InvalidateUser(userID)
+	return err
+}
+
+// GetAllForUser returns the unexpired tokens of a scope that belong to a user
+func (m TokenModel) GetAllForUser(scope string, userID int64) ([]*Token, error) {
+	query := `
+		SELECT hash, user_id, created_at, expiry, last_used_at, user_agent, scope
+		FROM tokens
+		WHERE scope = $1 AND user_id = $2 AND expiry > $3
+		ORDER BY created_at DESC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, scope, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []*Token{}
+	for rows.Next() {
+		var token Token
+		err := rows.Scan(
+			&token.Hash,
+			&token.UserID,
+			&token.CreatedAt,
+			&token.Expiry,
+			&token.LastUsedAt,
+			&token.UserAgent,
+			&token.Scope,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &token)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Delete revokes a token together with the rest of its family
+func (m TokenModel) Delete(tokenPlaintext string) error {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		DELETE FROM tokens
+		WHERE family = (SELECT family FROM tokens WHERE hash = $1)
+		RETURNING user_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.deleteReturningUser(ctx, query, tokenHash[:])
+}
+
+// Touch records that a token has just been used. The timestamp is only
+// refreshed once a minute so that busy clients don't write on every request
+func (m TokenModel) Touch(tokenPlaintext string) error {
+	if m.Cache.touchedRecently(tokenPlaintext) {
+		return nil
+	}
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+		UPDATE tokens
+		SET last_used_at = NOW()
+		WHERE hash = $1
+		AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, tokenHash[:])
+	return err
+}
+
+// DeleteFamily revokes every token descended from the same login
+func (m TokenModel) DeleteFamily(family []byte) error {
+	query := `
+		DELETE FROM tokens
+		WHERE family = $1
+		RETURNING user_id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.deleteReturningUser(ctx, query, family)
+}
+
+// deleteReturningUser runs a DELETE ... RETURNING user_id and drops the
+// cached lookups of the user whose tokens were removed. A family only
+// ever belongs to a single user
+func (m TokenModel) deleteReturningUser(ctx context.Context, query string, args ...interface{}) error {
+	var userID int64
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil
+		default:
+			return err
+		}
+	}
+	m.Cache.InvalidateUser(userID)
+	return nil
+}
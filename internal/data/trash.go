@@ -0,0 +1,159 @@
+// Filename: internal/data/trash.go
+
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GetTrashed() returns a trashed todo belonging to ownerID
+func (m TodoModel) GetTrashed(id int64, ownerID int64) (*Todo, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+		SELECT ` + todoColumns + `
+		FROM todo
+		WHERE id = $1
+		AND ` + todoAccess(2) + `
+		AND deleted_at IS NOT NULL
+	`
+	var todo Todo
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id, ownerID).Scan(todoDestinations(&todo)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &todo, nil
+}
+
+// GetTrash() returns a page of the trashed todos belonging to ownerID,
+// most recently deleted first
+func (m TodoModel) GetTrash(ownerID int64, filters Filters) ([]*Todo, Metadata, error) {
+	query := `
+		SELECT COUNT(*) OVER(), ` + todoColumns + `
+		FROM todo
+		WHERE deleted_at IS NOT NULL
+		AND ` + todoAccess(1) + `
+		ORDER BY deleted_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	rows, err := m.DB.QueryContext(ctx, query, ownerID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+	totalRecords := 0
+	todos := []*Todo{}
+	for rows.Next() {
+		var todo Todo
+		err := rows.Scan(append([]interface{}{&totalRecords}, todoDestinations(&todo)...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		todos = append(todos, &todo)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return todos, metadata, nil
+}
+
+// The Restore() method takes a todo belonging to ownerID out of the trash,
+// along with the subtasks that were trashed with it
+func (m TodoModel) Restore(id int64, ownerID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	//The subtasks restored share the deleted_at of the todo
+	var deletedAt time.Time
+	query := `
+		SELECT deleted_at FROM todo
+		WHERE id = $1
+		AND ` + todoAccess(2) + `
+		AND deleted_at IS NOT NULL
+		FOR UPDATE
+	`
+	err = tx.QueryRowContext(ctx, query, id, ownerID).Scan(&deletedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+	query = `
+		WITH RECURSIVE tree(id, deleted_at) AS (
+			SELECT id, deleted_at FROM todo
+			WHERE id = $1
+			AND ` + todoAccess(2) + `
+			AND deleted_at IS NOT NULL
+			UNION
+			SELECT todo.id, todo.deleted_at FROM todo
+			INNER JOIN tree ON todo.parent_id = tree.id
+			AND todo.deleted_at = tree.deleted_at
+		)
+		UPDATE todo
+		SET deleted_at = NULL, version = version + 1
+		WHERE id IN (SELECT id FROM tree)
+		RETURNING ` + todoColumns + `
+	`
+	todos, err := queryTodos(ctx, tx, query, id, ownerID)
+	if err != nil {
+		return err
+	}
+	for _, todo := range todos {
+		old := *todo
+		old.DeletedAt = &deletedAt
+		if err = recordHistory(ctx, tx, m.ActorID, HistoryRestore, &old, todo); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// The PurgeTrash() method permanently deletes the todos that have been in
+// the trash for longer than retention. It returns how many went, and the
+// storage keys of their attachments so that the files can be deleted too
+func (m TodoModel) PurgeTrash(retention time.Duration) (int64, []string, error) {
+	query := `
+		WITH purged AS (
+			DELETE FROM todo
+			WHERE deleted_at < NOW() - make_interval(secs => $1)
+			RETURNING id
+		)
+		SELECT (SELECT COUNT(*) FROM purged),
+			ARRAY(SELECT storage_key FROM todo_attachments WHERE todo_id IN (SELECT id FROM purged))
+	`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	var purged int64
+	var keys []string
+	err := m.DB.QueryRowContext(ctx, query, retention.Seconds()).Scan(&purged, pq.Array(&keys))
+	if err != nil {
+		return 0, nil, err
+	}
+	return purged, keys, nil
+}
@@ -7,6 +7,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"alysianorales.net/TODO/internal/validator"
@@ -28,6 +29,8 @@ type User struct {
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Version   int       `json:"-"`
+	// PendingEmail holds a new address until the user confirms it
+	PendingEmail string `json:"pending_email,omitempty"`
 }
 
 // Check if a user is anonymous
@@ -96,7 +99,8 @@ func ValidateUser(v *validator.Validator, user *User) {
 
 // Create our user model
 type UserModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *Cache
 }
 
 // Create a new user
@@ -128,10 +132,95 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+// Get user based on their id
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+	query := `
+	    SELECT id, created_at, name, email, password_hash, activated, version, pending_email
+		FROM users
+		WHERE id = $1
+	`
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&user.PendingEmail,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// GetAll returns a page of users filtered by name and email
+func (m UserModel) GetAll(name string, email string, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+	    SELECT COUNT(*) OVER(), id, created_at, name, email, password_hash, activated, version, pending_email
+		FROM users
+		WHERE (to_tsvector('simple', name) @@ plainto_tsquery('simple', $1) OR $1 = '')
+		AND (email = $2 OR $2 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortOrder())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{name, email, filters.limit(), filters.offset()}
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Version,
+			&user.PendingEmail,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	return users, metadata, nil
+}
+
 // Get user based on their email
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-	    SELECT id, created_at, name, email, password_hash, activated, version
+	    SELECT id, created_at, name, email, password_hash, activated, version, pending_email
 		FROM users
 		WHERE email = $1
 	`
@@ -148,6 +237,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.PendingEmail,
 	)
 
 	if err != nil {
@@ -166,8 +256,8 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 func (m UserModel) Update(user *User) error {
 	query := `
 	    UPDATE users
-		SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-		WHERE id = $5 AND version = $6
+		SET name = $1, email = $2, password_hash = $3, activated = $4, pending_email = $5, version = version + 1
+		WHERE id = $6 AND version = $7
 		RETURNING version
 	`
 	args := []interface{}{
@@ -175,6 +265,7 @@ func (m UserModel) Update(user *User) error {
 		user.Email,
 		user.Password.hash,
 		user.Activated,
+		user.PendingEmail,
 		user.ID,
 		user.Version,
 	}
@@ -185,20 +276,69 @@ func (m UserModel) Update(user *User) error {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
 		default:
 			return err
 		}
 	}
+	m.Cache.InvalidateUser(user.ID)
 
 	return nil
 
 }
 
+// Delete removes the user's account. Their tokens, permissions and todos
+// are removed by the ON DELETE CASCADE foreign keys. Todo history outlives
+// its todos, so the history of theirs is removed here
+func (m UserModel) Delete(user *User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	    DELETE FROM users
+		WHERE id = $1 AND version = $2
+	`
+	result, err := tx.ExecContext(ctx, query, user.ID, user.Version)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// Someone changed the account since it was read
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+	// The todos are gone by now, but every snapshot names its owner
+	query = `
+		DELETE FROM todo_history
+		WHERE (snapshot->>'user_id')::bigint = $1
+	`
+	_, err = tx.ExecContext(ctx, query, user.ID)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	m.Cache.InvalidateUser(user.ID)
+	return nil
+}
+
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 	// Setup query
 	query := `
-	    SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+	    SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version, users.pending_email, tokens.expiry
 		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
@@ -206,8 +346,16 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		AND tokens.scope = $2
 		AND tokens.expiry > $3
 	`
+	// Authentication tokens are looked up on every request, so they are cached
+	cacheable := tokenScope == ScopeAuthentication
+	if cacheable {
+		if user, ok := m.Cache.getUser(tokenPlaintext); ok {
+			return user, nil
+		}
+	}
 	args := []interface{}{tokenHash[:], tokenScope, time.Now()}
 	var user User
+	var tokenExpiry time.Time
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
@@ -219,6 +367,8 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.Password.hash,
 		&user.Activated,
 		&user.Version,
+		&user.PendingEmail,
+		&tokenExpiry,
 	)
 	if err != nil {
 		switch {
@@ -228,5 +378,8 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 			return nil, err
 		}
 	}
+	if cacheable {
+		m.Cache.setUser(tokenPlaintext, &user, tokenExpiry)
+	}
 	return &user, nil
 }
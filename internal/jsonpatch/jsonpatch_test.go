@@ -0,0 +1,227 @@
+// Filename: internal/jsonpatch/jsonpatch_test.go
+
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// The examples from Appendix A of RFC 6902, plus the cases the appendix
+// leaves out. An empty want means the patch must fail
+var applyTests = []struct {
+	name     string
+	doc      string
+	patch    string
+	want     string
+	testFail bool
+}{
+	{
+		name:  "A.1 adding an object member",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+		want:  `{"baz": "qux", "foo": "bar"}`,
+	},
+	{
+		name:  "A.2 adding an array element",
+		doc:   `{"foo": ["bar", "baz"]}`,
+		patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+		want:  `{"foo": ["bar", "qux", "baz"]}`,
+	},
+	{
+		name:  "A.3 removing an object member",
+		doc:   `{"baz": "qux", "foo": "bar"}`,
+		patch: `[{"op": "remove", "path": "/baz"}]`,
+		want:  `{"foo": "bar"}`,
+	},
+	{
+		name:  "A.4 removing an array element",
+		doc:   `{"foo": ["bar", "qux", "baz"]}`,
+		patch: `[{"op": "remove", "path": "/foo/1"}]`,
+		want:  `{"foo": ["bar", "baz"]}`,
+	},
+	{
+		name:  "A.5 replacing a value",
+		doc:   `{"baz": "qux", "foo": "bar"}`,
+		patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+		want:  `{"baz": "boo", "foo": "bar"}`,
+	},
+	{
+		name:  "A.6 moving a value",
+		doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+		patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+		want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+	},
+	{
+		name:  "A.7 moving an array element",
+		doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+		patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+		want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+	},
+	{
+		name: "A.8 testing a value: success",
+		doc:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		patch: `[
+			{"op": "test", "path": "/baz", "value": "qux"},
+			{"op": "test", "path": "/foo/1", "value": 2}
+		]`,
+		want: `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+	},
+	{
+		name:     "A.9 testing a value: error",
+		doc:      `{"baz": "qux"}`,
+		patch:    `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+		testFail: true,
+	},
+	{
+		name:  "A.10 adding a nested member object",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+		want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+	},
+	{
+		name:  "A.11 ignoring unrecognized elements",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+		want:  `{"foo": "bar", "baz": "qux"}`,
+	},
+	{
+		name:  "A.12 adding to a nonexistent target",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+	},
+	{
+		name:  "A.13 invalid JSON patch document",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "add", "path": "/baz", "value": "qux", "op": "remove"}]`,
+	},
+	{
+		name:  "A.14 ~ escape ordering",
+		doc:   `{"/": 9, "~1": 10}`,
+		patch: `[{"op": "test", "path": "/~01", "value": 10}]`,
+		want:  `{"/": 9, "~1": 10}`,
+	},
+	{
+		name:     "A.15 comparing strings and numbers",
+		doc:      `{"/": 9, "~1": 10}`,
+		patch:    `[{"op": "test", "path": "/~01", "value": "10"}]`,
+		testFail: true,
+	},
+	{
+		name:  "A.16 adding an array value",
+		doc:   `{"foo": ["bar"]}`,
+		patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+		want:  `{"foo": ["bar", ["abc", "def"]]}`,
+	},
+	{
+		name:  "moving a value to the same path",
+		doc:   `{"foo": {"bar": 1}}`,
+		patch: `[{"op": "move", "from": "/foo", "path": "/foo"}]`,
+		want:  `{"foo": {"bar": 1}}`,
+	},
+	{
+		name:  "moving a value into itself",
+		doc:   `{"foo": {"bar": 1}}`,
+		patch: `[{"op": "move", "from": "/foo", "path": "/foo/baz"}]`,
+	},
+	{
+		name:  "replacing the whole document",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "replace", "path": "", "value": {"baz": "qux"}}]`,
+		want:  `{"baz": "qux"}`,
+	},
+	{
+		name:  "copying a value",
+		doc:   `{"foo": {"bar": 1}}`,
+		patch: `[{"op": "copy", "from": "/foo", "path": "/baz"}, {"op": "add", "path": "/baz/bar", "value": 2}]`,
+		want:  `{"foo": {"bar": 1}, "baz": {"bar": 2}}`,
+	},
+	{
+		name:  "removing a missing member",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "remove", "path": "/baz"}]`,
+	},
+	{
+		name:  "an array index with a leading zero",
+		doc:   `{"foo": ["bar", "baz"]}`,
+		patch: `[{"op": "remove", "path": "/foo/01"}]`,
+	},
+	{
+		name:  "an unknown operation",
+		doc:   `{"foo": "bar"}`,
+		patch: `[{"op": "frobnicate", "path": "/foo"}]`,
+	},
+}
+
+func TestApply(t *testing.T) {
+	for _, tt := range applyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+			switch {
+			case tt.testFail:
+				if !errors.Is(err, ErrTestFailed) {
+					t.Fatalf("got error %v; want ErrTestFailed", err)
+				}
+			case tt.want == "":
+				if err == nil {
+					t.Fatalf("got %s; want an error", got)
+				}
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			default:
+				assertJSONEqual(t, got, tt.want)
+			}
+		})
+	}
+}
+
+// The examples from Appendix A of RFC 7396
+var mergeTests = []struct {
+	doc   string
+	patch string
+	want  string
+}{
+	{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+	{`{"a":"b"}`, `{"a":null}`, `{}`},
+	{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+	{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+	{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+	{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+	{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+	{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+	{`{"a":"b"}`, `["c"]`, `["c"]`},
+	{`{"a":"foo"}`, `null`, `null`},
+	{`{"a":"foo"}`, `"bar"`, `"bar"`},
+	{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+	{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+}
+
+func TestMerge(t *testing.T) {
+	for _, tt := range mergeTests {
+		t.Run(tt.doc+" + "+tt.patch, func(t *testing.T) {
+			got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("result is not JSON: %s", got)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("want is not JSON: %s", want)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s; want %s", got, want)
+	}
+}
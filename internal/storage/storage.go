@@ -0,0 +1,36 @@
+// Filename: internal/storage/storage.go
+
+// Package storage keeps the contents of uploaded files. The database only
+// records the key a file was stored under
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when nothing is stored under a key
+var ErrNotFound = errors.New("stored file not found")
+
+// A Store saves, reads and removes files by key
+type Store interface {
+	// Put() saves everything read from r under key. Nothing is kept when
+	// reading from r fails
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete() removes the file under key. Deleting a missing file is not
+	// an error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewKey() returns a random key for a new file
+func NewKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,5 @@
+-- Filename: migrations/000007_add_todo_owner.down.sql
+
+DELETE FROM permissions WHERE code = 'todo:admin';
+DROP INDEX IF EXISTS todo_user_id_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS user_id;
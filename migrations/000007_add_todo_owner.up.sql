@@ -0,0 +1,25 @@
+-- Filename: migrations/000007_add_todo_owner.up.sql
+
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users (id) ON DELETE CASCADE;
+
+-- Todos from before accounts existed go to the first user, preferring an
+-- activated one. Every todo needs an owner, so the migration stops when
+-- there is nobody to give them to
+UPDATE todo SET user_id = (
+    SELECT id FROM users ORDER BY activated DESC, id LIMIT 1
+)
+WHERE user_id IS NULL;
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM todo WHERE user_id IS NULL) THEN
+        RAISE EXCEPTION 'todos without an owner exist but there are no users to own them, create a user and run the migration again';
+    END IF;
+END $$;
+ALTER TABLE todo ALTER COLUMN user_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS todo_user_id_idx ON todo (user_id);
+
+-- todo:admin lets a user see and edit the todos of every owner
+INSERT INTO permissions (code)
+VALUES
+('todo:admin');
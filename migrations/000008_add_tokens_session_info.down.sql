@@ -0,0 +1,6 @@
+-- Filename: migrations/000008_add_tokens_session_info.down.sql
+
+DROP INDEX IF EXISTS tokens_user_id_scope_idx;
+ALTER TABLE tokens DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE tokens DROP COLUMN IF EXISTS last_used_at;
+ALTER TABLE tokens DROP COLUMN IF EXISTS created_at;
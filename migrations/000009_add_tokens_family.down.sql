@@ -0,0 +1,6 @@
+-- Filename: migrations/000009_add_tokens_family.down.sql
+
+DELETE FROM tokens WHERE scope = 'refresh';
+DROP INDEX IF EXISTS tokens_family_idx;
+ALTER TABLE tokens DROP COLUMN IF EXISTS used_at;
+ALTER TABLE tokens DROP COLUMN IF EXISTS family;
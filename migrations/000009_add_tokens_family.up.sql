@@ -0,0 +1,12 @@
+-- Filename: migrations/000009_add_tokens_family.up.sql
+
+-- Tokens issued from the same login share a family so that they can be
+-- revoked together. Existing tokens become families of one
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS family bytea;
+UPDATE tokens SET family = hash WHERE family IS NULL;
+ALTER TABLE tokens ALTER COLUMN family SET NOT NULL;
+
+-- Spent refresh tokens are kept until they expire so that reuse can be detected
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS used_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS tokens_family_idx ON tokens (family);
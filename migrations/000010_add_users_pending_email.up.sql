@@ -0,0 +1,4 @@
+-- Filename: migrations/000010_add_users_pending_email.up.sql
+
+-- A new email address waits here until the user confirms it
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email citext NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- Filename: migrations/000011_add_users_admin_permission.down.sql
+
+DELETE FROM permissions WHERE code = 'users:admin';
+DROP INDEX IF EXISTS permissions_code_idx;
@@ -0,0 +1,10 @@
+-- Filename: migrations/000011_add_users_admin_permission.up.sql
+
+-- Permission codes are looked up by name, so they must be unique
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_code_idx ON permissions (code);
+
+-- users:admin lets a user manage the permissions of other users
+INSERT INTO permissions (code)
+VALUES
+('users:admin')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,33 @@
+-- Filename: migrations/000012_add_roles.up.sql
+
+-- A role bundles permission codes so that they can be granted together
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    code text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY(role_id, permission_id)
+);
+
+-- a user may hold several roles
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles (id) ON DELETE CASCADE,
+    PRIMARY KEY(user_id, role_id)
+);
+
+INSERT INTO roles (code)
+VALUES
+('viewer'), ('editor'), ('admin')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE (roles.code = 'viewer' AND permissions.code IN ('todo:read'))
+OR (roles.code = 'editor' AND permissions.code IN ('todo:read', 'todo:write'))
+OR (roles.code = 'admin')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,10 @@
+-- Filename: migrations/000013_add_todo_search_indexes.down.sql
+
+DROP INDEX IF EXISTS todo_created_at_idx;
+DROP INDEX IF EXISTS todo_priority_idx;
+DROP INDEX IF EXISTS todo_status_idx;
+DROP INDEX IF EXISTS todo_search_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS search;
+DROP INDEX IF EXISTS todo_address_idx;
+DROP INDEX IF EXISTS todo_label_idx;
+DROP INDEX IF EXISTS todo_title_idx;
@@ -0,0 +1,20 @@
+-- Filename: migrations/000013_add_todo_search_indexes.up.sql
+
+-- Full-text indexes for the per-field filters
+CREATE INDEX IF NOT EXISTS todo_title_idx ON todo USING GIN(to_tsvector('simple', title));
+CREATE INDEX IF NOT EXISTS todo_label_idx ON todo USING GIN(to_tsvector('simple', label));
+CREATE INDEX IF NOT EXISTS todo_address_idx ON todo USING GIN(to_tsvector('simple', address));
+
+-- The q search runs over one weighted document so that title matches
+-- rank above label, task and address matches
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') ||
+    setweight(to_tsvector('simple', label), 'B') ||
+    setweight(to_tsvector('simple', task), 'C') ||
+    setweight(to_tsvector('simple', address), 'D')
+) STORED;
+CREATE INDEX IF NOT EXISTS todo_search_idx ON todo USING GIN(search);
+
+CREATE INDEX IF NOT EXISTS todo_status_idx ON todo (status);
+CREATE INDEX IF NOT EXISTS todo_priority_idx ON todo (priority);
+CREATE INDEX IF NOT EXISTS todo_created_at_idx ON todo (created_at);
@@ -0,0 +1,4 @@
+-- Filename: migrations/000014_add_todo_status_priority_checks.down.sql
+
+ALTER TABLE todo DROP CONSTRAINT IF EXISTS todo_priority_check;
+ALTER TABLE todo DROP CONSTRAINT IF EXISTS todo_status_check;
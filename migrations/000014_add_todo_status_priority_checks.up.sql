@@ -0,0 +1,27 @@
+-- Filename: migrations/000014_add_todo_status_priority_checks.up.sql
+
+-- Bring the free-text values in line with the fixed sets before they are enforced
+UPDATE todo SET status = lower(replace(trim(status), ' ', '_'));
+UPDATE todo SET status = CASE status
+    WHEN 'completed' THEN 'done'
+    WHEN 'complete' THEN 'done'
+    WHEN 'incomplete' THEN 'todo'
+    WHEN 'in-progress' THEN 'in_progress'
+    WHEN 'canceled' THEN 'cancelled'
+    ELSE status
+END;
+UPDATE todo SET status = 'todo'
+WHERE status NOT IN ('todo', 'in_progress', 'blocked', 'done', 'cancelled');
+
+UPDATE todo SET priority = lower(trim(priority));
+UPDATE todo SET priority = CASE priority
+    WHEN 'medium' THEN 'normal'
+    ELSE priority
+END;
+UPDATE todo SET priority = 'normal'
+WHERE priority NOT IN ('low', 'normal', 'high', 'urgent');
+
+ALTER TABLE todo ADD CONSTRAINT todo_status_check
+CHECK (status IN ('todo', 'in_progress', 'blocked', 'done', 'cancelled'));
+ALTER TABLE todo ADD CONSTRAINT todo_priority_check
+CHECK (priority IN ('low', 'normal', 'high', 'urgent'));
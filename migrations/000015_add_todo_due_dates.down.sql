@@ -0,0 +1,8 @@
+-- Filename: migrations/000015_add_todo_due_dates.down.sql
+
+DROP INDEX IF EXISTS todo_updated_at_idx;
+DROP INDEX IF EXISTS todo_due_at_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS reminded_at;
+ALTER TABLE todo DROP COLUMN IF EXISTS completed_at;
+ALTER TABLE todo DROP COLUMN IF EXISTS due_at;
+ALTER TABLE todo DROP COLUMN IF EXISTS updated_at;
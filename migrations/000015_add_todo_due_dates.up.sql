@@ -0,0 +1,13 @@
+-- Filename: migrations/000015_add_todo_due_dates.up.sql
+
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS due_at timestamp(0) with time zone;
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS completed_at timestamp(0) with time zone;
+-- reminded_at records when the owner was last emailed about the due date
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS reminded_at timestamp(0) with time zone;
+
+UPDATE todo SET updated_at = created_at;
+UPDATE todo SET completed_at = created_at WHERE status = 'done';
+
+CREATE INDEX IF NOT EXISTS todo_due_at_idx ON todo(due_at);
+CREATE INDEX IF NOT EXISTS todo_updated_at_idx ON todo(updated_at);
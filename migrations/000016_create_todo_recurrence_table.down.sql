@@ -0,0 +1,3 @@
+-- Filename: migrations/000016_create_todo_recurrence_table.down.sql
+
+DROP TABLE IF EXISTS todo_recurrence;
@@ -0,0 +1,16 @@
+-- Filename: migrations/000016_create_todo_recurrence_table.up.sql
+
+-- A todo repeats when it has a row here. The rule moves on to the next
+-- todo in the series when the current one is done
+CREATE TABLE IF NOT EXISTS todo_recurrence (
+    todo_id bigint PRIMARY KEY REFERENCES todo ON DELETE CASCADE,
+    frequency text NOT NULL,
+    interval integer NOT NULL DEFAULT 1,
+    by_weekday text[] NOT NULL DEFAULT '{}',
+    until timestamp(0) with time zone,
+    count integer NOT NULL DEFAULT 0,
+    occurrence integer NOT NULL DEFAULT 1,
+    CONSTRAINT todo_recurrence_frequency_check CHECK (frequency IN ('daily', 'weekly', 'monthly')),
+    CONSTRAINT todo_recurrence_interval_check CHECK (interval BETWEEN 1 AND 365),
+    CONSTRAINT todo_recurrence_end_check CHECK (until IS NULL OR count = 0)
+);
@@ -0,0 +1,6 @@
+-- Filename: migrations/000017_add_todo_subtasks_dependencies.down.sql
+
+DROP TABLE IF EXISTS todo_dependencies;
+DROP TABLE IF EXISTS todo_checklist_items;
+DROP INDEX IF EXISTS todo_parent_id_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,25 @@
+-- Filename: migrations/000017_add_todo_subtasks_dependencies.up.sql
+
+-- Child todos belong to their parent and go with it
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS parent_id bigint REFERENCES todo ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS todo_parent_id_idx ON todo(parent_id);
+
+-- Checklist items are lighter than child todos: just text and a done flag
+CREATE TABLE IF NOT EXISTS todo_checklist_items (
+    id bigserial PRIMARY KEY,
+    todo_id bigint NOT NULL REFERENCES todo ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    text text NOT NULL,
+    done boolean NOT NULL DEFAULT false,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS todo_checklist_items_todo_id_idx ON todo_checklist_items(todo_id);
+
+-- todo_id cannot be completed while blocked_by_id is open
+CREATE TABLE IF NOT EXISTS todo_dependencies (
+    todo_id bigint NOT NULL REFERENCES todo ON DELETE CASCADE,
+    blocked_by_id bigint NOT NULL REFERENCES todo ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, blocked_by_id),
+    CONSTRAINT todo_dependencies_self_check CHECK (todo_id <> blocked_by_id)
+);
+CREATE INDEX IF NOT EXISTS todo_dependencies_blocked_by_id_idx ON todo_dependencies(blocked_by_id);
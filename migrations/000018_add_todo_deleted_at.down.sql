@@ -0,0 +1,5 @@
+-- Filename: migrations/000018_add_todo_deleted_at.down.sql
+
+DELETE FROM todo WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS todo_deleted_at_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS deleted_at;
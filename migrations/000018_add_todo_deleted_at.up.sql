@@ -0,0 +1,5 @@
+-- Filename: migrations/000018_add_todo_deleted_at.up.sql
+
+-- A todo with a deleted_at is in the trash until the purge job removes it
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+CREATE INDEX IF NOT EXISTS todo_deleted_at_idx ON todo(deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,3 @@
+-- Filename: migrations/000019_create_todo_history_table.down.sql
+
+DROP TABLE IF EXISTS todo_history;
@@ -0,0 +1,16 @@
+-- Filename: migrations/000019_create_todo_history_table.up.sql
+
+-- One row per change to a todo. snapshot is the todo after the change, so
+-- that it can be reverted to that version
+CREATE TABLE IF NOT EXISTS todo_history (
+    id bigserial PRIMARY KEY,
+    todo_id bigint NOT NULL REFERENCES todo ON DELETE CASCADE,
+    version integer NOT NULL,
+    action text NOT NULL,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    changes jsonb NOT NULL DEFAULT '{}',
+    snapshot jsonb NOT NULL,
+    CONSTRAINT todo_history_action_check CHECK (action IN ('create', 'update', 'delete', 'restore'))
+);
+CREATE INDEX IF NOT EXISTS todo_history_todo_id_version_idx ON todo_history(todo_id, version);
@@ -0,0 +1,7 @@
+-- Filename: migrations/000020_create_lists.down.sql
+
+DROP INDEX IF EXISTS todo_list_id_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS list_id;
+DROP TABLE IF EXISTS list_invitations;
+DROP TABLE IF EXISTS list_members;
+DROP TABLE IF EXISTS lists;
@@ -0,0 +1,39 @@
+-- Filename: migrations/000020_create_lists.up.sql
+
+-- Lists group todos and can be shared with other users
+CREATE TABLE IF NOT EXISTS lists (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    version integer NOT NULL DEFAULT 1
+);
+
+-- Every member of a list has one role on it
+CREATE TABLE IF NOT EXISTS list_members (
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role text NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, user_id),
+    CONSTRAINT list_members_role_check CHECK (role IN ('viewer', 'editor', 'owner'))
+);
+CREATE INDEX IF NOT EXISTS list_members_user_id_idx ON list_members(user_id);
+
+-- Invitations are addressed to an email so that people without an
+-- account yet can be invited. Only the hash of the token is kept
+CREATE TABLE IF NOT EXISTS list_invitations (
+    hash bytea PRIMARY KEY,
+    list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+    email citext NOT NULL,
+    role text NOT NULL,
+    invited_by bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    expiry timestamp(0) with time zone NOT NULL,
+    CONSTRAINT list_invitations_role_check CHECK (role IN ('viewer', 'editor', 'owner'))
+);
+CREATE INDEX IF NOT EXISTS list_invitations_list_id_idx ON list_invitations(list_id);
+
+-- Todos taken out of a deleted list go back to the people who created them
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS list_id bigint REFERENCES lists ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS todo_list_id_idx ON todo(list_id);
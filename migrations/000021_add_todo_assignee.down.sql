@@ -0,0 +1,4 @@
+-- Filename: migrations/000021_add_todo_assignee.down.sql
+
+DROP INDEX IF EXISTS todo_assignee_id_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS assignee_id;
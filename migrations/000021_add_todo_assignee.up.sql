@@ -0,0 +1,6 @@
+-- Filename: migrations/000021_add_todo_assignee.up.sql
+
+-- A todo can be handed to someone who can see it. Deleting the account
+-- leaves the todo unassigned
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS assignee_id bigint REFERENCES users ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS todo_assignee_id_idx ON todo(assignee_id);
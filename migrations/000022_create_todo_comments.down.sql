@@ -0,0 +1,4 @@
+-- Filename: migrations/000022_create_todo_comments.down.sql
+
+DROP TABLE IF EXISTS todo_comment_edits;
+DROP TABLE IF EXISTS todo_comments;
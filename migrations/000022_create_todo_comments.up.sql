@@ -0,0 +1,22 @@
+-- Filename: migrations/000022_create_todo_comments.up.sql
+
+-- Comments outlive the accounts of their authors
+CREATE TABLE IF NOT EXISTS todo_comments (
+    id bigserial PRIMARY KEY,
+    todo_id bigint NOT NULL REFERENCES todo ON DELETE CASCADE,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    edited_at timestamp(0) with time zone,
+    body text NOT NULL,
+    version integer NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS todo_comments_todo_id_idx ON todo_comments(todo_id, id);
+
+-- Each edit keeps the body it replaced
+CREATE TABLE IF NOT EXISTS todo_comment_edits (
+    id bigserial PRIMARY KEY,
+    comment_id bigint NOT NULL REFERENCES todo_comments ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    body text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS todo_comment_edits_comment_id_idx ON todo_comment_edits(comment_id);
@@ -0,0 +1,3 @@
+-- Filename: migrations/000023_create_todo_attachments.down.sql
+
+DROP TABLE IF EXISTS todo_attachments;
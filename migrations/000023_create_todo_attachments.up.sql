@@ -0,0 +1,16 @@
+-- Filename: migrations/000023_create_todo_attachments.up.sql
+
+-- The contents of each file are kept in storage under storage_key, and
+-- checksum is the hex SHA-256 of those contents
+CREATE TABLE IF NOT EXISTS todo_attachments (
+    id bigserial PRIMARY KEY,
+    todo_id bigint NOT NULL REFERENCES todo ON DELETE CASCADE,
+    user_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    filename text NOT NULL,
+    content_type text NOT NULL,
+    size bigint NOT NULL CHECK (size >= 0),
+    checksum text NOT NULL,
+    storage_key text NOT NULL UNIQUE
+);
+CREATE INDEX IF NOT EXISTS todo_attachments_todo_id_idx ON todo_attachments(todo_id, id);
@@ -0,0 +1,22 @@
+-- Filename: migrations/000024_create_tags.down.sql
+
+-- Tags go back into the mode arrays of their todos. mode_length_check is
+-- not restored, as todos may now have no tags or more than five
+ALTER TABLE todo ADD COLUMN IF NOT EXISTS mode text[] NOT NULL DEFAULT '{}';
+UPDATE todo SET mode = ARRAY(
+    SELECT tags.name::text
+    FROM todo_tags
+    INNER JOIN tags ON tags.id = todo_tags.tag_id
+    WHERE todo_tags.todo_id = todo.id
+    ORDER BY tags.name
+);
+ALTER TABLE todo ALTER COLUMN mode DROP DEFAULT;
+CREATE INDEX IF NOT EXISTS todo_mode_idx ON todo USING GIN(mode);
+
+UPDATE todo_history SET snapshot = (snapshot - 'tags') || jsonb_build_object('mode', snapshot->'tags')
+WHERE snapshot ? 'tags';
+UPDATE todo_history SET changes = (changes - 'tags') || jsonb_build_object('mode', changes->'tags')
+WHERE changes ? 'tags';
+
+DROP TABLE IF EXISTS todo_tags;
+DROP TABLE IF EXISTS tags;
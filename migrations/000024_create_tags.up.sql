@@ -0,0 +1,57 @@
+-- Filename: migrations/000024_create_tags.up.sql
+
+-- Tags belong to the owner of the todos they are on, and names are unique
+-- per owner regardless of case
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name citext NOT NULL,
+    color text NOT NULL DEFAULT '#9e9e9e',
+    version integer NOT NULL DEFAULT 1,
+    CONSTRAINT tags_user_id_name_key UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS todo_tags (
+    todo_id bigint NOT NULL REFERENCES todo ON DELETE CASCADE,
+    tag_id bigint NOT NULL REFERENCES tags ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS todo_tags_tag_id_idx ON todo_tags(tag_id);
+
+-- Every entry of a todo's mode becomes a tag of its owner. An entry too
+-- long to be a tag name would be lost when the column is dropped, so the
+-- migration stops instead
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM todo CROSS JOIN LATERAL unnest(todo.mode) AS m(name) WHERE octet_length(btrim(replace(m.name, ',', ' '))) > 50) THEN
+        RAISE EXCEPTION 'some modes are longer than the 50 bytes a tag name can have, shorten them and run the migration again';
+    END IF;
+END $$;
+
+-- Commas are used to list tags in query strings, so they are replaced
+INSERT INTO tags (user_id, name)
+SELECT DISTINCT todo.user_id, btrim(replace(m.name, ',', ' '))::citext
+FROM todo
+CROSS JOIN LATERAL unnest(todo.mode) AS m(name)
+WHERE btrim(replace(m.name, ',', ' ')) <> ''
+ON CONFLICT (user_id, name) DO NOTHING;
+
+INSERT INTO todo_tags (todo_id, tag_id)
+SELECT DISTINCT todo.id, tags.id
+FROM todo
+CROSS JOIN LATERAL unnest(todo.mode) AS m(name)
+INNER JOIN tags ON tags.user_id = todo.user_id
+AND tags.name = btrim(replace(m.name, ',', ' '))::citext
+ON CONFLICT DO NOTHING;
+
+-- The history calls the field by its new name, so old versions can still
+-- be reverted to
+UPDATE todo_history SET snapshot = (snapshot - 'mode') || jsonb_build_object('tags', snapshot->'mode')
+WHERE snapshot ? 'mode';
+UPDATE todo_history SET changes = (changes - 'mode') || jsonb_build_object('tags', changes->'mode')
+WHERE changes ? 'mode';
+
+ALTER TABLE todo DROP CONSTRAINT IF EXISTS mode_length_check;
+DROP INDEX IF EXISTS todo_mode_idx;
+ALTER TABLE todo DROP COLUMN IF EXISTS mode;
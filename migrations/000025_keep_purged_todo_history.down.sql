@@ -0,0 +1,6 @@
+-- Filename: migrations/000025_keep_purged_todo_history.down.sql
+
+-- The history of todos that have since been purged has nothing to refer to
+DELETE FROM todo_history WHERE todo_id NOT IN (SELECT id FROM todo);
+ALTER TABLE todo_history ADD CONSTRAINT todo_history_todo_id_fkey
+    FOREIGN KEY (todo_id) REFERENCES todo ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+-- Filename: migrations/000025_keep_purged_todo_history.up.sql
+
+-- History outlives its todo, so that purging the trash doesn't wipe the
+-- audit trail. todo_id stays as a plain id, and each snapshot still holds
+-- the whole todo. History is only removed with the account of its owner
+ALTER TABLE todo_history DROP CONSTRAINT IF EXISTS todo_history_todo_id_fkey;